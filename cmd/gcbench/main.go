@@ -0,0 +1,301 @@
+// Command gcbench measures what a big map costs the garbage collector,
+// depending on the type of its keys and values.
+//
+// It fills a map with uuids, forces a number of collections, and prints how
+// long they took, the distribution of the stop the world pauses, and what the
+// heap looked like, from runtime/metrics:
+//
+//	gcbench -keys string -n 10000000
+//	gcbench -keys uuid -values string -rounds 20 -json
+//
+// -keys string stores the uuids as their 36 character text, uuid as
+// [16]byte, and offheap as text in an offheap.Map, whose values are always
+// strings (-values int stores the number as text there).
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/antoniomo/gobench/pkg/offheap"
+)
+
+const (
+	pausesMetric    = "/sched/pauses/total/gc:seconds"
+	liveMetric      = "/gc/heap/live:bytes"
+	objectsMetric   = "/gc/heap/objects:objects"
+	scanHeapMetric  = "/gc/scan/heap:bytes"
+	heapBytesMetric = "/memory/classes/heap/objects:bytes"
+	cyclesMetric    = "/gc/cycles/total:gc-cycles"
+)
+
+type config struct {
+	Keys     string        `json:"keys"`
+	Values   string        `json:"values"`
+	Elements int           `json:"elements"`
+	Rounds   int           `json:"rounds"`
+	Sleep    time.Duration `json:"sleep_ns"`
+}
+
+// Quantiles ...
+type Quantiles struct {
+	P50 time.Duration `json:"p50_ns"`
+	P90 time.Duration `json:"p90_ns"`
+	P99 time.Duration `json:"p99_ns"`
+	Max time.Duration `json:"max_ns"`
+}
+
+// Result is what gcbench prints, as a table or as JSON.
+type Result struct {
+	Config config `json:"config"`
+	// GCTime is the wall time of each runtime.GC call: mark, sweep and
+	// pauses.
+	GCTime Quantiles `json:"gc_time"`
+	// Pauses is the stop the world pauses of the rounds, from the runtime's
+	// histogram, so they're rounded up to its buckets.
+	Pauses      Quantiles `json:"pauses"`
+	PauseCount  uint64    `json:"pause_count"`
+	Cycles      uint64    `json:"gc_cycles"`
+	LiveBytes   uint64    `json:"heap_live_bytes"`
+	HeapBytes   uint64    `json:"heap_object_bytes"`
+	HeapObjects uint64    `json:"heap_objects"`
+	// ScanBytes is how much of the heap the GC has to scan for pointers.
+	ScanBytes uint64        `json:"heap_scan_bytes"`
+	FillTime  time.Duration `json:"fill_time_ns"`
+}
+
+func main() {
+	var (
+		c        config
+		jsonOut  bool
+		keyTypes = []string{"string", "uuid", "offheap"}
+	)
+	flag.StringVar(&c.Keys, "keys", "string", "key type: string, uuid or offheap")
+	flag.StringVar(&c.Values, "values", "int", "value type: int or string")
+	flag.IntVar(&c.Elements, "n", 10000000, "number of map entries")
+	flag.IntVar(&c.Rounds, "rounds", 10, "number of forced collections")
+	flag.DurationVar(&c.Sleep, "sleep", 0, "time to sleep between collections")
+	flag.BoolVar(&jsonOut, "json", false, "print JSON instead of a table")
+	flag.Parse()
+
+	if !slices.Contains(keyTypes, c.Keys) || c.Values != "int" && c.Values != "string" || c.Elements < 0 || c.Rounds < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	r := run(c)
+	var err error
+	if jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(r)
+	} else {
+		err = r.print(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(c config) Result {
+	r := Result{Config: c}
+
+	start := time.Now()
+	m := fill(c)
+	r.FillTime = time.Since(start)
+	runtime.GC() // the garbage left from filling the map
+
+	samples := []metrics.Sample{
+		{Name: pausesMetric},
+		{Name: cyclesMetric},
+	}
+	metrics.Read(samples)
+	// Read reuses the histogram the next time, so keep a copy.
+	pauses := samples[0].Value.Float64Histogram()
+	pauses = &metrics.Float64Histogram{Counts: slices.Clone(pauses.Counts), Buckets: pauses.Buckets}
+	cycles := samples[1].Value.Uint64()
+
+	times := make([]time.Duration, c.Rounds)
+	for i := range times {
+		if i > 0 {
+			time.Sleep(c.Sleep)
+		}
+		t := time.Now()
+		runtime.GC()
+		times[i] = time.Since(t)
+	}
+
+	samples = append(samples,
+		metrics.Sample{Name: liveMetric},
+		metrics.Sample{Name: objectsMetric},
+		metrics.Sample{Name: scanHeapMetric},
+		metrics.Sample{Name: heapBytesMetric},
+	)
+	metrics.Read(samples)
+	runtime.KeepAlive(m)
+
+	r.GCTime = durationQuantiles(times)
+	r.Pauses, r.PauseCount = histogramQuantiles(pauses, samples[0].Value.Float64Histogram())
+	r.Cycles = samples[1].Value.Uint64() - cycles
+	r.LiveBytes = samples[2].Value.Uint64()
+	r.HeapObjects = samples[3].Value.Uint64()
+	r.ScanBytes = samples[4].Value.Uint64()
+	r.HeapBytes = samples[5].Value.Uint64()
+	return r
+}
+
+// fill returns the map to measure, for the caller to keep alive.
+func fill(c config) any {
+	switch c.Keys + "/" + c.Values {
+	case "string/int":
+		return fillMap(c.Elements, uuidString, func(i int) int { return i })
+	case "string/string":
+		return fillMap(c.Elements, uuidString, strconv.Itoa)
+	case "uuid/int":
+		return fillMap(c.Elements, uuid, func(i int) int { return i })
+	case "uuid/string":
+		return fillMap(c.Elements, uuid, strconv.Itoa)
+	default:
+		m := offheap.NewWithCapacity(c.Elements)
+		for i := 0; i < c.Elements; i++ {
+			m.Set(uuidString(), strconv.Itoa(i))
+		}
+		return m
+	}
+}
+
+func fillMap[K comparable, V any](n int, key func() K, value func(int) V) map[K]V {
+	m := make(map[K]V, n)
+	for i := 0; i < n; i++ {
+		m[key()] = value(i)
+	}
+	return m
+}
+
+// uuid returns a random, version 4, uuid.
+func uuid() [16]byte {
+	var u [16]byte
+	binary.LittleEndian.PutUint64(u[:8], rand.Uint64())
+	binary.LittleEndian.PutUint64(u[8:], rand.Uint64())
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return u
+}
+
+func uuidString() string {
+	u := uuid()
+	var b [36]byte
+	hex.Encode(b[:8], u[:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return string(b[:])
+}
+
+func durationQuantiles(d []time.Duration) Quantiles {
+	d = slices.Clone(d)
+	slices.Sort(d)
+	at := func(q float64) time.Duration {
+		return d[max(int(math.Ceil(q*float64(len(d))))-1, 0)]
+	}
+	return Quantiles{P50: at(.5), P90: at(.9), P99: at(.99), Max: d[len(d)-1]}
+}
+
+// histogramQuantiles returns the quantiles of what was added to a runtime
+// histogram between two reads, and how many samples that was. Each quantile
+// is the upper bound of the bucket it falls in.
+func histogramQuantiles(before, after *metrics.Float64Histogram) (Quantiles, uint64) {
+	counts := make([]uint64, len(after.Counts))
+	var total uint64
+	for i := range counts {
+		counts[i] = after.Counts[i] - before.Counts[i]
+		total += counts[i]
+	}
+	if total == 0 {
+		return Quantiles{}, 0
+	}
+	bound := func(i int) time.Duration {
+		b := after.Buckets[i+1]
+		if math.IsInf(b, 1) {
+			b = after.Buckets[i]
+		}
+		return time.Duration(b * float64(time.Second))
+	}
+	at := func(q float64) time.Duration {
+		rank := uint64(math.Ceil(q * float64(total)))
+		var seen uint64
+		for i, n := range counts {
+			if seen += n; seen >= max(rank, 1) {
+				return bound(i)
+			}
+		}
+		return bound(len(counts) - 1)
+	}
+	var q Quantiles
+	q.P50, q.P90, q.P99 = at(.5), at(.9), at(.99)
+	for i := len(counts) - 1; i >= 0; i-- {
+		if counts[i] > 0 {
+			q.Max = bound(i)
+			break
+		}
+	}
+	return q, total
+}
+
+func (r Result) print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	c := r.Config
+	fmt.Fprintf(tw, "keys\tvalues\tentries\trounds\tfill time\n")
+	fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\n\n", c.Keys, c.Values, c.Elements, c.Rounds, r.FillTime.Round(time.Millisecond))
+	fmt.Fprintf(tw, "\tp50\tp90\tp99\tmax\n")
+	for _, row := range []struct {
+		name string
+		q    Quantiles
+	}{
+		{"gc time", r.GCTime},
+		{fmt.Sprintf("pause (%d)", r.PauseCount), r.Pauses},
+	} {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", row.name, us(row.q.P50), us(row.q.P90), us(row.q.P99), us(row.q.Max))
+	}
+	fmt.Fprintf(tw, "\ngc cycles\t%d\n", r.Cycles)
+	fmt.Fprintf(tw, "heap live\t%s\n", bytes(r.LiveBytes))
+	fmt.Fprintf(tw, "heap objects\t%s in %d objects\n", bytes(r.HeapBytes), r.HeapObjects)
+	fmt.Fprintf(tw, "heap to scan\t%s\n", bytes(r.ScanBytes))
+	return tw.Flush()
+}
+
+func us(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
+
+func bytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
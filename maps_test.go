@@ -1,13 +1,25 @@
 package main
 
 import (
+	"fmt"
+	"runtime"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/antoniomo/gobench/pkg/hamt"
+	"github.com/antoniomo/gobench/pkg/leftright"
 	"github.com/antoniomo/gobench/pkg/lock"
+	"github.com/antoniomo/gobench/pkg/lockfree"
+	"github.com/antoniomo/gobench/pkg/offheap"
 	"github.com/antoniomo/gobench/pkg/readheavy"
 	"github.com/antoniomo/gobench/pkg/rwlock"
+	"github.com/antoniomo/gobench/pkg/sharded"
+	"github.com/antoniomo/gobench/pkg/skiplist"
 )
 
 const (
@@ -20,7 +32,16 @@ var (
 )
 
 func BenchmarkLockInsert(b *testing.B) {
-	m := lock.New()
+	m := lock.New[string, string]()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+}
+
+func BenchmarkLockInsertWithCapacity(b *testing.B) {
+	m := lock.NewWithCapacity[string, string](b.N)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -29,60 +50,1055 @@ func BenchmarkLockInsert(b *testing.B) {
 }
 
 func BenchmarkRWLockInsert(b *testing.B) {
-	m := rwlock.New()
+	m := rwlock.New[string, string]()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+}
+
+func BenchmarkRWLockInsertWithCapacity(b *testing.B) {
+	m := rwlock.NewWithCapacity[string, string](b.N)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+}
+
+func BenchmarkShardedInsert(b *testing.B) {
+	m := sharded.New[string, string](0, nil)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+}
+
+func BenchmarkSyncMapInsert(b *testing.B) {
+	m := sync.Map{}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Store(strconv.Itoa(i), "asdfasdf")
+	}
+}
+
+func BenchmarkLockFreeInsert(b *testing.B) {
+	m := lockfree.New[string, string]()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+}
+
+func BenchmarkOffHeapInsert(b *testing.B) {
+	m := offheap.New()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+}
+
+func BenchmarkLockLoadOrStore(b *testing.B) {
+	m := lock.New[string, string]()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		V, _ = m.LoadOrStore(strconv.Itoa(i%testelements), "asdfasdf")
+	}
+}
+
+func BenchmarkLockCompareAndSwap(b *testing.B) {
+	m := lock.New[string, string]()
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		m.CompareAndSwap(strconv.Itoa(i%testelements), "asdfasdf", "asdfasdf")
+	}
+}
+
+func BenchmarkLockUpdate(b *testing.B) {
+	m := lock.New[string, string]()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Update(strconv.Itoa(i%testelements), func(old string, ok bool) (string, bool) {
+			return "asdfasdf", !ok
+		})
+	}
+}
+
+func BenchmarkRWLockLoadOrStore(b *testing.B) {
+	m := rwlock.New[string, string]()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		V, _ = m.LoadOrStore(strconv.Itoa(i%testelements), "asdfasdf")
+	}
+}
+
+func BenchmarkRWLockCompareAndSwap(b *testing.B) {
+	m := rwlock.New[string, string]()
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		m.CompareAndSwap(strconv.Itoa(i%testelements), "asdfasdf", "asdfasdf")
+	}
+}
+
+func BenchmarkRWLockUpdate(b *testing.B) {
+	m := rwlock.New[string, string]()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Update(strconv.Itoa(i%testelements), func(old string, ok bool) (string, bool) {
+			return "asdfasdf", !ok
+		})
+	}
+}
+
+// sync.Map has no compute operation, the closest is a LoadOrStore followed
+// by a CompareAndDelete, which is what Update with a toggling f does.
+
+func BenchmarkSyncMapLoadOrStore(b *testing.B) {
+	m := sync.Map{}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		v, _ := m.LoadOrStore(strconv.Itoa(i%testelements), "asdfasdf")
+		V = v.(string)
+	}
+}
+
+func BenchmarkSyncMapCompareAndSwap(b *testing.B) {
+	m := sync.Map{}
+
+	for i := 0; i < testelements; i++ {
+		m.Store(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		m.CompareAndSwap(strconv.Itoa(i%testelements), "asdfasdf", "asdfasdf")
+	}
+}
+
+func BenchmarkSyncMapUpdate(b *testing.B) {
+	m := sync.Map{}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		k := strconv.Itoa(i % testelements)
+		if _, loaded := m.LoadOrStore(k, "asdfasdf"); loaded {
+			m.CompareAndDelete(k, "asdfasdf")
+		}
+	}
+}
+
+// The parallel insert benchmarks hammer a single map from every P, which is
+// where a single mutex starts to hurt and sharding should pay off.
+
+var parallelID int64
+
+func parallelKeys(pb *testing.PB, set func(k string)) {
+	prefix := strconv.FormatInt(atomic.AddInt64(&parallelID, 1), 10) + "-"
+	for i := 0; pb.Next(); i++ {
+		set(prefix + strconv.Itoa(i))
+	}
+}
+
+func BenchmarkLockInsertParallel(b *testing.B) {
+	m := lock.New[string, string]()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		parallelKeys(pb, func(k string) { m.Set(k, "asdfasdf") })
+	})
+}
+
+func BenchmarkRWLockInsertParallel(b *testing.B) {
+	m := rwlock.New[string, string]()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		parallelKeys(pb, func(k string) { m.Set(k, "asdfasdf") })
+	})
+}
+
+func BenchmarkShardedInsertParallel(b *testing.B) {
+	m := sharded.New[string, string](0, nil)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		parallelKeys(pb, func(k string) { m.Set(k, "asdfasdf") })
+	})
+}
+
+func BenchmarkSyncMapInsertParallel(b *testing.B) {
+	m := sync.Map{}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		parallelKeys(pb, func(k string) { m.Store(k, "asdfasdf") })
+	})
+}
+
+func BenchmarkLockFreeInsertParallel(b *testing.B) {
+	m := lockfree.New[string, string]()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		parallelKeys(pb, func(k string) { m.Set(k, "asdfasdf") })
+	})
+}
+
+func BenchmarkReadHeavyInsert(b *testing.B) {
+	m := readheavy.New[string, string]()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+}
+
+func BenchmarkLeftRightInsert(b *testing.B) {
+	m := leftright.New[string, string]()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+}
+
+func BenchmarkSkipListInsert(b *testing.B) {
+	m := skiplist.New[string, string]()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+}
+
+func BenchmarkReadHeavyExtend(b *testing.B) {
+	m := readheavy.New[string, string]()
+	mm := make(map[string]string)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < testelements; j++ {
+			mm[strconv.Itoa(i)] = "asdfasdf"
+		}
+		m.Extend(mm)
+	}
+}
+
+func BenchmarkReadHeavyExtendSlice(b *testing.B) {
+	m := readheavy.New[string, string]()
+	mm := make([]readheavy.Tuple[string, string], testelements)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < testelements; j++ {
+			mm[j] = readheavy.Tuple[string, string]{Key: strconv.Itoa(i), Value: "asdfasdf"}
+		}
+		m.ExtendSlice(mm)
+	}
+}
+
+func BenchmarkHAMTInsert(b *testing.B) {
+	m := hamt.New[string, string]()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+}
+
+func BenchmarkHAMTExtend(b *testing.B) {
+	m := hamt.New[string, string]()
+	mm := make(map[string]string)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < testelements; j++ {
+			mm[strconv.Itoa(i)] = "asdfasdf"
+		}
+		m.Extend(mm)
+	}
+}
+
+func BenchmarkHAMTExtendSlice(b *testing.B) {
+	m := hamt.New[string, string]()
+	mm := make([]hamt.Tuple[string, string], testelements)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < testelements; j++ {
+			mm[j] = hamt.Tuple[string, string]{Key: strconv.Itoa(i), Value: "asdfasdf"}
+		}
+		m.ExtendSlice(mm)
+	}
+}
+
+// The crossover benchmarks overwrite keys in a map already holding size of
+// them, which is where the full copy of readheavy stops paying off against
+// the path copy of hamt.
+
+var crossoverSizes = []int{10, 100, 1000, 10000, 100000}
+
+func BenchmarkReadHeavySetCrossover(b *testing.B) {
+	for _, size := range crossoverSizes {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			m := readheavy.New[string, string]()
+			mm := make(map[string]string, size)
+			for i := 0; i < size; i++ {
+				mm[strconv.Itoa(i)] = "asdfasdf"
+			}
+			m.Extend(mm)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				m.Set(strconv.Itoa(i%size), "qwerqwer")
+			}
+		})
+	}
+}
+
+func BenchmarkReadHeavyWithCapacitySetCrossover(b *testing.B) {
+	for _, size := range crossoverSizes {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			m := readheavy.NewWithCapacity[string, string](size)
+			mm := make(map[string]string, size)
+			for i := 0; i < size; i++ {
+				mm[strconv.Itoa(i)] = "asdfasdf"
+			}
+			m.Extend(mm)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				m.Set(strconv.Itoa(i%size), "qwerqwer")
+			}
+		})
+	}
+}
+
+func BenchmarkHAMTSetCrossover(b *testing.B) {
+	for _, size := range crossoverSizes {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			m := hamt.New[string, string]()
+			mm := make(map[string]string, size)
+			for i := 0; i < size; i++ {
+				mm[strconv.Itoa(i)] = "asdfasdf"
+			}
+			m.Extend(mm)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				m.Set(strconv.Itoa(i%size), "qwerqwer")
+			}
+		})
+	}
+}
+
+func BenchmarkReadHeavyGet(b *testing.B) {
+	m := readheavy.New[string, string]()
+	mm := make(map[string]string)
+
+	for i := 0; i < testelements; i++ {
+		mm[strconv.Itoa(i)] = "asdfasdf"
+	}
+	m.Extend(mm)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		V, _ = m.Get(strconv.Itoa(i % testelements))
+	}
+}
+
+func BenchmarkLeftRightGet(b *testing.B) {
+	m := leftright.New[string, string]()
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		V, _ = m.Get(strconv.Itoa(i % testelements))
+	}
+}
+
+func BenchmarkSkipListGet(b *testing.B) {
+	m := skiplist.New[string, string]()
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		V, _ = m.Get(strconv.Itoa(i % testelements))
+	}
+}
+
+func BenchmarkOffHeapGet(b *testing.B) {
+	m := offheap.New()
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		V, _ = m.Get(strconv.Itoa(i % testelements))
+	}
+}
+
+func BenchmarkHAMTGet(b *testing.B) {
+	m := hamt.New[string, string]()
+	mm := make(map[string]string)
+
+	for i := 0; i < testelements; i++ {
+		mm[strconv.Itoa(i)] = "asdfasdf"
+	}
+	m.Extend(mm)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		V, _ = m.Get(strconv.Itoa(i % testelements))
+	}
+}
+
+func BenchmarkLockFreeGet(b *testing.B) {
+	m := lockfree.New[string, string]()
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		V, _ = m.Get(strconv.Itoa(i % testelements))
+	}
+}
+
+// The read scaling benchmarks run the same parallel reads at every
+// GOMAXPROCS from 1 to all cores. Perfect scaling keeps ns/op, which is per
+// read across all goroutines, dividing by the number of procs.
+
+func readScaling(b *testing.B, m interface{ Get(string) (string, bool) }) {
+	procs := []int{}
+	for p := 1; p < runtime.NumCPU(); p *= 2 {
+		procs = append(procs, p)
+	}
+	procs = append(procs, runtime.NumCPU())
+
+	keys := make([]string, testelements)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	for _, p := range procs {
+		b.Run(fmt.Sprintf("procs=%d", p), func(b *testing.B) {
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(p))
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					m.Get(keys[i%testelements])
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkRWLockReadScaling(b *testing.B) {
+	m := rwlock.New[string, string]()
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	readScaling(b, m)
+}
+
+func BenchmarkRWLockReaderBiasedReadScaling(b *testing.B) {
+	m := rwlock.NewReaderBiased[string, string]()
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	readScaling(b, m)
+}
+
+func BenchmarkRWLockReaderBiasedMixedParallel(b *testing.B) {
+	m := rwlock.NewReaderBiased[string, string]()
+	mixedParallel(b, func(k string) { m.Get(k) }, m.Set)
+}
+
+func BenchmarkLeftRightReadScaling(b *testing.B) {
+	m := leftright.New[string, string]()
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	readScaling(b, m)
+}
+
+// The mixed benchmarks have every goroutine read testelements keys, writing
+// one in every readsPerWrite operations.
+
+const readsPerWrite = 10
+
+func mixedParallel(b *testing.B, get func(k string), set func(k, v string)) {
+	keys := make([]string, testelements)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		set(keys[i], "asdfasdf")
+	}
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			k := keys[i%testelements]
+			if i%readsPerWrite == 0 {
+				set(k, "qwerqwer")
+			} else {
+				get(k)
+			}
+		}
+	})
+}
+
+func BenchmarkLockMixedParallel(b *testing.B) {
+	m := lock.New[string, string]()
+	mixedParallel(b, func(k string) { m.Get(k) }, m.Set)
+}
+
+func BenchmarkRWLockMixedParallel(b *testing.B) {
+	m := rwlock.New[string, string]()
+	mixedParallel(b, func(k string) { m.Get(k) }, m.Set)
+}
+
+func BenchmarkSyncMapMixedParallel(b *testing.B) {
+	var m sync.Map
+	mixedParallel(b, func(k string) { m.Load(k) }, func(k, v string) { m.Store(k, v) })
+}
+
+func BenchmarkReadHeavyMixedParallel(b *testing.B) {
+	m := readheavy.New[string, string]()
+	mixedParallel(b, func(k string) { m.Get(k) }, m.Set)
+}
+
+func BenchmarkLockFreeMixedParallel(b *testing.B) {
+	m := lockfree.New[string, string]()
+	mixedParallel(b, func(k string) { m.Get(k) }, m.Set)
+}
+
+func BenchmarkLeftRightMixedParallel(b *testing.B) {
+	m := leftright.New[string, string]()
+	mixedParallel(b, func(k string) { m.Get(k) }, m.Set)
+}
+
+func BenchmarkSkipListMixedParallel(b *testing.B) {
+	m := skiplist.New[string, string]()
+	mixedParallel(b, func(k string) { m.Get(k) }, m.Set)
+}
+
+// BenchmarkReadHeavyUpdate makes the same writes as BenchmarkReadHeavyExtend,
+// plus as many deletes, in a single Update.
+func BenchmarkReadHeavyUpdate(b *testing.B) {
+	m := readheavy.New[string, string]()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Update(func(tx *readheavy.Tx[string, string]) {
+			for j := 0; j < testelements; j++ {
+				tx.Set(strconv.Itoa(i), "asdfasdf")
+				tx.Delete(strconv.Itoa(i - 1))
+			}
+		})
+	}
+}
+
+func BenchmarkReadHeavyCoalescerInsert(b *testing.B) {
+	m := readheavy.New[string, string]()
+	c := readheavy.NewCoalescer(m, time.Millisecond, testelements)
+	defer c.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	c.Flush()
+}
+
+// The batch benchmarks compare a loop of single operations, each taking the
+// lock, with the bulk ones taking it once per batch.
+
+var batchSizes = []int{1, 8, 64, 512}
+
+func batchKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	return keys
+}
+
+func BenchmarkLockGetLoop(b *testing.B) {
+	for _, size := range batchSizes {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			m := lock.New[string, string]()
+			keys := batchKeys(size)
+			for _, k := range keys {
+				m.Set(k, "asdfasdf")
+			}
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				for _, k := range keys {
+					V, _ = m.Get(k)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLockGetMany(b *testing.B) {
+	for _, size := range batchSizes {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			m := lock.New[string, string]()
+			keys := batchKeys(size)
+			for _, k := range keys {
+				m.Set(k, "asdfasdf")
+			}
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				for _, r := range m.GetMany(keys) {
+					V = r.Value
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLockGetLoopParallel(b *testing.B) {
+	for _, size := range batchSizes {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			m := lock.New[string, string]()
+			keys := batchKeys(size)
+			for _, k := range keys {
+				m.Set(k, "asdfasdf")
+			}
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					for _, k := range keys {
+						m.Get(k)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkLockGetManyParallel(b *testing.B) {
+	for _, size := range batchSizes {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			m := lock.New[string, string]()
+			keys := batchKeys(size)
+			for _, k := range keys {
+				m.Set(k, "asdfasdf")
+			}
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					m.GetMany(keys)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkLockSetMany(b *testing.B) {
+	for _, size := range batchSizes {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			m := lock.New[string, string]()
+			batch := make([]lock.Tuple[string, string], size)
+			for i, k := range batchKeys(size) {
+				batch[i] = lock.Tuple[string, string]{Key: k, Value: "asdfasdf"}
+			}
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				m.SetMany(batch)
+			}
+		})
+	}
+}
+
+func BenchmarkLockDeleteMany(b *testing.B) {
+	for _, size := range batchSizes {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			m := lock.New[string, string]()
+			keys := batchKeys(size)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				m.DeleteMany(keys)
+			}
+		})
+	}
+}
+
+func BenchmarkRWLockGetLoop(b *testing.B) {
+	for _, size := range batchSizes {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			m := rwlock.New[string, string]()
+			keys := batchKeys(size)
+			for _, k := range keys {
+				m.Set(k, "asdfasdf")
+			}
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				for _, k := range keys {
+					V, _ = m.Get(k)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRWLockGetMany(b *testing.B) {
+	for _, size := range batchSizes {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			m := rwlock.New[string, string]()
+			keys := batchKeys(size)
+			for _, k := range keys {
+				m.Set(k, "asdfasdf")
+			}
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				for _, r := range m.GetMany(keys) {
+					V = r.Value
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRWLockGetLoopParallel(b *testing.B) {
+	for _, size := range batchSizes {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			m := rwlock.New[string, string]()
+			keys := batchKeys(size)
+			for _, k := range keys {
+				m.Set(k, "asdfasdf")
+			}
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					for _, k := range keys {
+						m.Get(k)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkRWLockGetManyParallel(b *testing.B) {
+	for _, size := range batchSizes {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			m := rwlock.New[string, string]()
+			keys := batchKeys(size)
+			for _, k := range keys {
+				m.Set(k, "asdfasdf")
+			}
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					m.GetMany(keys)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkRWLockSetMany(b *testing.B) {
+	for _, size := range batchSizes {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			m := rwlock.New[string, string]()
+			batch := make([]rwlock.Tuple[string, string], size)
+			for i, k := range batchKeys(size) {
+				batch[i] = rwlock.Tuple[string, string]{Key: k, Value: "asdfasdf"}
+			}
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				m.SetMany(batch)
+			}
+		})
+	}
+}
+
+func BenchmarkRWLockDeleteMany(b *testing.B) {
+	for _, size := range batchSizes {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			m := rwlock.New[string, string]()
+			keys := batchKeys(size)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				m.DeleteMany(keys)
+			}
+		})
+	}
+}
+
+func BenchmarkLockIter(b *testing.B) {
+	m := lock.New[string, string]()
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for kv := range m.Iter() {
+			K, V = kv.Key, kv.Value
+		}
+	}
+}
+
+func BenchmarkLockIterSlice(b *testing.B) {
+	m := lock.New[string, string]()
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for kv := range m.IterSlice() {
+			K, V = kv.Key, kv.Value
+		}
+	}
+}
+
+func BenchmarkLockSnapRange(b *testing.B) {
+	m := lock.New[string, string]()
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for k, v := range m.Snapshot() {
+			K, V = k, v
+		}
+	}
+}
+
+func BenchmarkLockSliceRange(b *testing.B) {
+	m := lock.New[string, string]()
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, kv := range m.SliceSnapshot() {
+			K, V = kv.Key, kv.Value
+		}
+	}
+}
+
+func BenchmarkLockAll(b *testing.B) {
+	m := lock.New[string, string]()
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for k, v := range m.All() {
+			K, V = k, v
+		}
+	}
+}
+
+func BenchmarkLockKeys(b *testing.B) {
+	m := lock.New[string, string]()
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for k := range m.Keys() {
+			K = k
+		}
+	}
+}
+
+func BenchmarkLockValues(b *testing.B) {
+	m := lock.New[string, string]()
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for v := range m.Values() {
+			V = v
+		}
+	}
+}
 
+func BenchmarkLockRange(b *testing.B) {
+	m := lock.New[string, string]()
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
 	b.ResetTimer()
+
 	for i := 0; i < b.N; i++ {
+		m.Range(func(k, v string) bool {
+			K, V = k, v
+			return true
+		})
+	}
+}
+
+func BenchmarkRWLockIter(b *testing.B) {
+	m := rwlock.New[string, string]()
+
+	for i := 0; i < testelements; i++ {
 		m.Set(strconv.Itoa(i), "asdfasdf")
 	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for kv := range m.Iter() {
+			K, V = kv.Key, kv.Value
+		}
+	}
 }
 
-func BenchmarkSyncMapInsert(b *testing.B) {
-	m := sync.Map{}
+func BenchmarkRWLockIterSlice(b *testing.B) {
+	m := rwlock.New[string, string]()
 
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
 	b.ResetTimer()
+
 	for i := 0; i < b.N; i++ {
-		m.Store(strconv.Itoa(i), "asdfasdf")
+		for kv := range m.IterSlice() {
+			K, V = kv.Key, kv.Value
+		}
 	}
 }
 
-func BenchmarkReadHeavyInsert(b *testing.B) {
-	m := readheavy.New()
+func BenchmarkRWLockSnapRange(b *testing.B) {
+	m := rwlock.New[string, string]()
 
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
 	b.ResetTimer()
+
 	for i := 0; i < b.N; i++ {
+		for k, v := range m.Snapshot() {
+			K, V = k, v
+		}
+	}
+}
+
+func BenchmarkRWLockSliceRange(b *testing.B) {
+	m := rwlock.New[string, string]()
+
+	for i := 0; i < testelements; i++ {
 		m.Set(strconv.Itoa(i), "asdfasdf")
 	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, kv := range m.SliceSnapshot() {
+			K, V = kv.Key, kv.Value
+		}
+	}
 }
 
-func BenchmarkReadHeavyExtend(b *testing.B) {
-	m := readheavy.New()
-	mm := make(map[string]string)
+func BenchmarkRWLockAll(b *testing.B) {
+	m := rwlock.New[string, string]()
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for k, v := range m.All() {
+			K, V = k, v
+		}
+	}
+}
+
+func BenchmarkRWLockKeys(b *testing.B) {
+	m := rwlock.New[string, string]()
 
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
 	b.ResetTimer()
+
 	for i := 0; i < b.N; i++ {
-		for j := 0; j < testelements; j++ {
-			mm[strconv.Itoa(i)] = "asdfasdf"
+		for k := range m.Keys() {
+			K = k
 		}
-		m.Extend(mm)
 	}
 }
 
-func BenchmarkReadHeavyExtendSlice(b *testing.B) {
-	m := readheavy.New()
-	mm := make([]readheavy.Tuple, testelements)
+func BenchmarkRWLockValues(b *testing.B) {
+	m := rwlock.New[string, string]()
 
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
 	b.ResetTimer()
+
 	for i := 0; i < b.N; i++ {
-		for j := 0; j < testelements; j++ {
-			mm[j] = readheavy.Tuple{Key: strconv.Itoa(i), Value: "asdfasdf"}
+		for v := range m.Values() {
+			V = v
 		}
-		m.ExtendSlice(mm)
 	}
 }
 
-func BenchmarkLockIter(b *testing.B) {
-	m := lock.New()
+func BenchmarkRWLockRange(b *testing.B) {
+	m := rwlock.New[string, string]()
 
 	for i := 0; i < testelements; i++ {
 		m.Set(strconv.Itoa(i), "asdfasdf")
@@ -90,14 +1106,30 @@ func BenchmarkLockIter(b *testing.B) {
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		for kv := range m.Iter() {
-			K, V = kv.Key, kv.Value
+		m.Range(func(k, v string) bool {
+			K, V = k, v
+			return true
+		})
+	}
+}
+
+func BenchmarkLeftRightAll(b *testing.B) {
+	m := leftright.New[string, string]()
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for k, v := range m.All() {
+			K, V = k, v
 		}
 	}
 }
 
-func BenchmarkLockIterSlice(b *testing.B) {
-	m := lock.New()
+func BenchmarkLeftRightKeys(b *testing.B) {
+	m := leftright.New[string, string]()
 
 	for i := 0; i < testelements; i++ {
 		m.Set(strconv.Itoa(i), "asdfasdf")
@@ -105,14 +1137,14 @@ func BenchmarkLockIterSlice(b *testing.B) {
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		for kv := range m.IterSlice() {
-			K, V = kv.Key, kv.Value
+		for k := range m.Keys() {
+			K = k
 		}
 	}
 }
 
-func BenchmarkLockSnapRange(b *testing.B) {
-	m := lock.New()
+func BenchmarkSkipListAll(b *testing.B) {
+	m := skiplist.New[string, string]()
 
 	for i := 0; i < testelements; i++ {
 		m.Set(strconv.Itoa(i), "asdfasdf")
@@ -120,14 +1152,40 @@ func BenchmarkLockSnapRange(b *testing.B) {
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		for k, v := range m.Snapshot() {
+		for k, v := range m.All() {
 			K, V = k, v
 		}
 	}
 }
 
-func BenchmarkLockSliceRange(b *testing.B) {
-	m := lock.New()
+// The sorted benchmarks walk the keys in order, all of them or the ones in
+// [rangeFrom, rangeTo), about a tenth of them. Without an ordered map, that
+// takes a snapshot and a sort.
+
+const (
+	rangeFrom = "3"
+	rangeTo   = "4"
+)
+
+func BenchmarkRWLockSorted(b *testing.B) {
+	m := rwlock.New[string, string]()
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s := m.SliceSnapshot()
+		slices.SortFunc(s, func(a, b rwlock.Tuple[string, string]) int { return strings.Compare(a.Key, b.Key) })
+		for _, kv := range s {
+			K, V = kv.Key, kv.Value
+		}
+	}
+}
+
+func BenchmarkSkipListSorted(b *testing.B) {
+	m := skiplist.New[string, string]()
 
 	for i := 0; i < testelements; i++ {
 		m.Set(strconv.Itoa(i), "asdfasdf")
@@ -141,8 +1199,44 @@ func BenchmarkLockSliceRange(b *testing.B) {
 	}
 }
 
-func BenchmarkRWLockIter(b *testing.B) {
-	m := rwlock.New()
+func BenchmarkRWLockSortedRange(b *testing.B) {
+	m := rwlock.New[string, string]()
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s := m.SliceSnapshot()
+		slices.SortFunc(s, func(a, b rwlock.Tuple[string, string]) int { return strings.Compare(a.Key, b.Key) })
+		from, _ := slices.BinarySearchFunc(s, rangeFrom, func(kv rwlock.Tuple[string, string], k string) int { return strings.Compare(kv.Key, k) })
+		for _, kv := range s[from:] {
+			if kv.Key >= rangeTo {
+				break
+			}
+			K, V = kv.Key, kv.Value
+		}
+	}
+}
+
+func BenchmarkSkipListSortedRange(b *testing.B) {
+	m := skiplist.New[string, string]()
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for k, v := range m.Range(rangeFrom, rangeTo) {
+			K, V = k, v
+		}
+	}
+}
+
+func BenchmarkShardedIter(b *testing.B) {
+	m := sharded.New[string, string](0, nil)
 
 	for i := 0; i < testelements; i++ {
 		m.Set(strconv.Itoa(i), "asdfasdf")
@@ -156,8 +1250,8 @@ func BenchmarkRWLockIter(b *testing.B) {
 	}
 }
 
-func BenchmarkRWLockIterSlice(b *testing.B) {
-	m := rwlock.New()
+func BenchmarkShardedIterSlice(b *testing.B) {
+	m := sharded.New[string, string](0, nil)
 
 	for i := 0; i < testelements; i++ {
 		m.Set(strconv.Itoa(i), "asdfasdf")
@@ -171,8 +1265,8 @@ func BenchmarkRWLockIterSlice(b *testing.B) {
 	}
 }
 
-func BenchmarkRWLockSnapRange(b *testing.B) {
-	m := rwlock.New()
+func BenchmarkShardedSnapRange(b *testing.B) {
+	m := sharded.New[string, string](0, nil)
 
 	for i := 0; i < testelements; i++ {
 		m.Set(strconv.Itoa(i), "asdfasdf")
@@ -186,8 +1280,8 @@ func BenchmarkRWLockSnapRange(b *testing.B) {
 	}
 }
 
-func BenchmarkRWLockSliceRange(b *testing.B) {
-	m := rwlock.New()
+func BenchmarkShardedSliceRange(b *testing.B) {
+	m := sharded.New[string, string](0, nil)
 
 	for i := 0; i < testelements; i++ {
 		m.Set(strconv.Itoa(i), "asdfasdf")
@@ -201,6 +1295,67 @@ func BenchmarkRWLockSliceRange(b *testing.B) {
 	}
 }
 
+func BenchmarkShardedAll(b *testing.B) {
+	m := sharded.New[string, string](0, nil)
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for k, v := range m.All() {
+			K, V = k, v
+		}
+	}
+}
+
+func BenchmarkShardedKeys(b *testing.B) {
+	m := sharded.New[string, string](0, nil)
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for k := range m.Keys() {
+			K = k
+		}
+	}
+}
+
+func BenchmarkShardedValues(b *testing.B) {
+	m := sharded.New[string, string](0, nil)
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for v := range m.Values() {
+			V = v
+		}
+	}
+}
+
+func BenchmarkShardedRange(b *testing.B) {
+	m := sharded.New[string, string](0, nil)
+
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "asdfasdf")
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		m.Range(func(k, v string) bool {
+			K, V = k, v
+			return true
+		})
+	}
+}
+
 func BenchmarkSyncMapRange(b *testing.B) {
 	m := sync.Map{}
 
@@ -218,7 +1373,7 @@ func BenchmarkSyncMapRange(b *testing.B) {
 }
 
 func BenchmarkReadHeavyIter(b *testing.B) {
-	m := readheavy.New()
+	m := readheavy.New[string, string]()
 	mm := make(map[string]string)
 
 	for i := 0; i < testelements; i++ {
@@ -235,7 +1390,7 @@ func BenchmarkReadHeavyIter(b *testing.B) {
 }
 
 func BenchmarkReadHeavySnapRange(b *testing.B) {
-	m := readheavy.New()
+	m := readheavy.New[string, string]()
 	mm := make(map[string]string)
 
 	for i := 0; i < testelements; i++ {
@@ -245,8 +1400,77 @@ func BenchmarkReadHeavySnapRange(b *testing.B) {
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		for k, v := range m.Snapshot() {
+		for k, v := range m.Snapshot().All() {
+			K, V = k, v
+		}
+	}
+}
+
+func BenchmarkReadHeavyAll(b *testing.B) {
+	m := readheavy.New[string, string]()
+	mm := make(map[string]string)
+
+	for i := 0; i < testelements; i++ {
+		mm[strconv.Itoa(i)] = "asdfasdf"
+	}
+	m.Extend(mm)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for k, v := range m.All() {
 			K, V = k, v
 		}
 	}
 }
+
+func BenchmarkReadHeavyKeys(b *testing.B) {
+	m := readheavy.New[string, string]()
+	mm := make(map[string]string)
+
+	for i := 0; i < testelements; i++ {
+		mm[strconv.Itoa(i)] = "asdfasdf"
+	}
+	m.Extend(mm)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for k := range m.Keys() {
+			K = k
+		}
+	}
+}
+
+func BenchmarkReadHeavyValues(b *testing.B) {
+	m := readheavy.New[string, string]()
+	mm := make(map[string]string)
+
+	for i := 0; i < testelements; i++ {
+		mm[strconv.Itoa(i)] = "asdfasdf"
+	}
+	m.Extend(mm)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for v := range m.Values() {
+			V = v
+		}
+	}
+}
+
+func BenchmarkReadHeavyRange(b *testing.B) {
+	m := readheavy.New[string, string]()
+	mm := make(map[string]string)
+
+	for i := 0; i < testelements; i++ {
+		mm[strconv.Itoa(i)] = "asdfasdf"
+	}
+	m.Extend(mm)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		m.Range(func(k, v string) bool {
+			K, V = k, v
+			return true
+		})
+	}
+}
@@ -0,0 +1,230 @@
+// Package matrix is BenchmarkMatrix, on its own so that it builds apart from
+// the benchmarks in the repository root.
+package matrix
+
+import (
+	"flag"
+	"fmt"
+	"iter"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+	"github.com/antoniomo/gobench/pkg/hamt"
+	"github.com/antoniomo/gobench/pkg/leftright"
+	"github.com/antoniomo/gobench/pkg/lock"
+	"github.com/antoniomo/gobench/pkg/lockfree"
+	"github.com/antoniomo/gobench/pkg/offheap"
+	"github.com/antoniomo/gobench/pkg/readheavy"
+	"github.com/antoniomo/gobench/pkg/rwlock"
+	"github.com/antoniomo/gobench/pkg/sharded"
+	"github.com/antoniomo/gobench/pkg/skiplist"
+)
+
+var (
+	K string
+	V string
+)
+
+// MixedParallel writes one in every readsPerWrite operations, as the mixed
+// benchmarks in maps_test.go do.
+const readsPerWrite = 10
+
+// matrixMap is what an implementation needs to be in the matrix.
+type matrixMap interface {
+	Get(key string) (string, bool)
+	Set(key, value string)
+	Delete(key string)
+	All() iter.Seq2[string, string]
+}
+
+// matrixImpls registers the implementations, one line each. new gets the
+// size the map is going to be filled to.
+var matrixImpls = []struct {
+	name string
+	new  func(size int) matrixMap
+}{
+	{"Lock", func(n int) matrixMap { return lock.NewWithCapacity[string, string](n) }},
+	{"RWLock", func(n int) matrixMap { return rwlock.NewWithCapacity[string, string](n) }},
+	{"RWLockReaderBiased", func(n int) matrixMap { return rwlock.NewReaderBiasedWithCapacity[string, string](n) }},
+	{"Sharded", func(int) matrixMap { return sharded.New[string, string](0, nil) }},
+	{"SyncMap", func(int) matrixMap { return &syncMap{} }},
+	{"ReadHeavy", func(n int) matrixMap { return readheavy.NewWithCapacity[string, string](n) }},
+	{"HAMT", func(int) matrixMap { return hamt.New[string, string]() }},
+	{"LockFree", func(n int) matrixMap { return lockfree.NewWithCapacity[string, string](n) }},
+	{"LeftRight", func(n int) matrixMap { return leftright.NewWithCapacity[string, string](n) }},
+	{"SkipList", func(int) matrixMap { return skiplist.New[string, string]() }},
+	{"OffHeap", func(n int) matrixMap { return offheap.NewWithCapacity(n) }},
+}
+
+var (
+	matrixSizes      = []int{10, 100, 1000, 10000, 100000, 1000000, 10000000}
+	matrixKeyLens    = []int{8, 32, 128}
+	matrixValueSizes = []int{8, 256, 4096}
+
+	matrixMaxSize = flag.Int("matrix.maxsize", 100000, "biggest map size BenchmarkMatrix fills")
+)
+
+// matrixOps are run on a map filled with keys, which they must leave as
+// they found it, as the next one gets the same map.
+var matrixOps = []struct {
+	name string
+	run  func(b *testing.B, m matrixMap, keys []string, value string)
+}{
+	{"Get", func(b *testing.B, m matrixMap, keys []string, _ string) {
+		for i := 0; i < b.N; i++ {
+			V, _ = m.Get(keys[i%len(keys)])
+		}
+	}},
+	{"GetMissing", func(b *testing.B, m matrixMap, keys []string, _ string) {
+		missing := make([]string, len(keys))
+		for i, k := range keys {
+			missing[i] = k + "?"
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			V, _ = m.Get(missing[i%len(missing)])
+		}
+	}},
+	{"Set", func(b *testing.B, m matrixMap, keys []string, value string) {
+		for i := 0; i < b.N; i++ {
+			m.Set(keys[i%len(keys)], value)
+		}
+	}},
+	// DeleteSet deletes a key and sets it back, so the size stays put.
+	{"DeleteSet", func(b *testing.B, m matrixMap, keys []string, value string) {
+		for i := 0; i < b.N; i++ {
+			k := keys[i%len(keys)]
+			m.Delete(k)
+			m.Set(k, value)
+		}
+	}},
+	{"MixedParallel", func(b *testing.B, m matrixMap, keys []string, value string) {
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				k := keys[i%len(keys)]
+				if i%readsPerWrite == 0 {
+					m.Set(k, value)
+				} else {
+					m.Get(k)
+				}
+			}
+		})
+	}},
+	// All is per entry, so that sizes compare.
+	{"All", func(b *testing.B, m matrixMap, keys []string, _ string) {
+		for i := 0; i < b.N; {
+			for k, v := range m.All() {
+				K, V = k, v
+				if i++; i == b.N {
+					break
+				}
+			}
+		}
+	}},
+}
+
+// BenchmarkMatrix runs the same operations on every implementation in
+// matrixImpls, for every combination of map size, key length and value size:
+//
+//	BenchmarkMatrix/impl=Lock/size=1000/key=32/value=256/op=Get
+//
+//	go test ./matrix -run XXX -bench 'Matrix/impl=Lock$/size=1000$/'
+//
+// Pick a slice of it with -bench, and compare implementations with
+// benchstat -col /impl. Sizes go up to -matrix.maxsize, as the biggest ones
+// take a lot of memory and time to fill.
+func BenchmarkMatrix(b *testing.B) {
+	for _, impl := range matrixImpls {
+		b.Run("impl="+impl.name, func(b *testing.B) {
+			for _, size := range matrixSizes {
+				if size > *matrixMaxSize {
+					break
+				}
+				b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+					for _, keyLen := range matrixKeyLens {
+						b.Run(fmt.Sprintf("key=%d", keyLen), func(b *testing.B) {
+							keys := matrixKeys(size, keyLen)
+							for _, valueSize := range matrixValueSizes {
+								b.Run(fmt.Sprintf("value=%d", valueSize), func(b *testing.B) {
+									value := strings.Repeat("v", valueSize)
+									m := impl.new(size)
+									matrixFill(m, keys, value)
+									for _, op := range matrixOps {
+										b.Run("op="+op.name, func(b *testing.B) {
+											b.ResetTimer()
+											op.run(b, m, keys, value)
+										})
+									}
+								})
+							}
+						})
+					}
+				})
+			}
+		})
+	}
+}
+
+// matrixKeys returns n distinct keys of keyLen bytes, or as many as n's
+// digits if that's more. The digits come first, so that keys don't all
+// start the same.
+func matrixKeys(n, keyLen int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		k := strconv.Itoa(i)
+		keys[i] = k + strings.Repeat("k", max(keyLen-len(k), 0))
+	}
+	return keys
+}
+
+// matrixFill sets every key, in bulk if the map can, as setting them one by
+// one copies the whole map every time for some.
+func matrixFill(m matrixMap, keys []string, value string) {
+	type extender interface {
+		ExtendSlice(e []cmap.Tuple[string, string])
+	}
+	type setManyer interface {
+		SetMany(e []cmap.Tuple[string, string])
+	}
+	switch mm := m.(type) {
+	case extender, setManyer:
+		e := make([]cmap.Tuple[string, string], len(keys))
+		for i, k := range keys {
+			e[i] = cmap.Tuple[string, string]{Key: k, Value: value}
+		}
+		if x, ok := mm.(extender); ok {
+			x.ExtendSlice(e)
+		} else {
+			mm.(setManyer).SetMany(e)
+		}
+	default:
+		for _, k := range keys {
+			m.Set(k, value)
+		}
+	}
+}
+
+// syncMap puts sync.Map in the matrix.
+type syncMap struct {
+	m sync.Map
+}
+
+func (s *syncMap) Get(key string) (string, bool) {
+	v, ok := s.m.Load(key)
+	if !ok {
+		return "", false
+	}
+	return v.(string), true
+}
+
+func (s *syncMap) Set(key, value string) { s.m.Store(key, value) }
+func (s *syncMap) Delete(key string)     { s.m.Delete(key) }
+
+func (s *syncMap) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		s.m.Range(func(k, v any) bool { return yield(k.(string), v.(string)) })
+	}
+}
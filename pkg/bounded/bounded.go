@@ -0,0 +1,236 @@
+// Package bounded is a map built like lock.Map that caps its own growth,
+// evicting entries once it goes over a maximum entry count or an approximate
+// byte budget.
+package bounded
+
+import (
+	"iter"
+	"sync"
+	"unsafe"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+)
+
+// Policy picks which entry to evict.
+type Policy int
+
+const (
+	// LRU evicts the least recently used entry.
+	LRU Policy = iota
+	// LFU evicts the least frequently used entry, the least recently used
+	// one among ties.
+	LFU
+	// CLOCK approximates LRU with a reference bit per entry and a sweeping
+	// hand, so hits don't have to reorder anything.
+	CLOCK
+)
+
+func (p Policy) String() string {
+	switch p {
+	case LRU:
+		return "LRU"
+	case LFU:
+		return "LFU"
+	case CLOCK:
+		return "CLOCK"
+	}
+	return "Policy(?)"
+}
+
+// policy keeps the eviction order. Its methods are called with the map lock
+// held.
+type policy[K comparable] interface {
+	add(key K)
+	touch(key K)
+	remove(key K)
+	// victim picks the next entry to evict and forgets it.
+	victim() K
+}
+
+// Options ...
+type Options[K comparable, V any] struct {
+	Policy Policy
+	// MaxEntries caps the entry count, if positive.
+	MaxEntries int
+	// MaxBytes caps the sum of Size over all the entries, if positive.
+	MaxBytes int64
+	// Size estimates the memory held by an entry. The default counts the key
+	// and value themselves, plus the bytes of string and []byte ones.
+	Size func(key K, value V) int64
+	// OnEvict is called for every evicted entry, after the map lock is
+	// released, so it may call back into the map. It's not called for Delete.
+	OnEvict func(key K, value V)
+}
+
+type entry[V any] struct {
+	value V
+	size  int64
+}
+
+// Map ...
+type Map[K comparable, V any] struct {
+	mu     sync.Mutex
+	m      map[K]entry[V]
+	bytes  int64
+	policy policy[K]
+	opts   Options[K, V]
+}
+
+// New ...
+func New[K comparable, V any](opts Options[K, V]) *Map[K, V] {
+	ret := &Map[K, V]{
+		m:    make(map[K]entry[V]),
+		opts: opts,
+	}
+	if ret.opts.Size == nil {
+		ret.opts.Size = defaultSize[K, V]
+	}
+	switch opts.Policy {
+	case LFU:
+		ret.policy = newLFU[K]()
+	case CLOCK:
+		ret.policy = newClock[K]()
+	default:
+		ret.policy = newLRU[K]()
+	}
+	return ret
+}
+
+func defaultSize[K comparable, V any](key K, value V) int64 {
+	return int64(unsafe.Sizeof(key)) + int64(unsafe.Sizeof(value)) +
+		dynamicSize(any(key)) + dynamicSize(any(value))
+}
+
+func dynamicSize(x any) int64 {
+	switch x := x.(type) {
+	case string:
+		return int64(len(x))
+	case []byte:
+		return int64(cap(x))
+	}
+	return 0
+}
+
+// Get counts as a use for the eviction policy.
+func (m *Map[K, V]) Get(key K) (V, bool) {
+	m.mu.Lock()
+	e, ok := m.m[key]
+	if ok {
+		m.policy.touch(key)
+	}
+	m.mu.Unlock()
+	return e.value, ok
+}
+
+// Set may evict other entries, or even the new one if it doesn't fit on its
+// own.
+func (m *Map[K, V]) Set(key K, value V) {
+	e := entry[V]{value: value, size: m.opts.Size(key, value)}
+	m.mu.Lock()
+	if old, ok := m.m[key]; ok {
+		m.bytes -= old.size
+		m.policy.touch(key)
+	} else {
+		m.policy.add(key)
+	}
+	m.m[key] = e
+	m.bytes += e.size
+	evicted := m.evict()
+	m.mu.Unlock()
+
+	if m.opts.OnEvict != nil {
+		for _, kv := range evicted {
+			m.opts.OnEvict(kv.Key, kv.Value)
+		}
+	}
+}
+
+func (m *Map[K, V]) over() bool {
+	return (m.opts.MaxEntries > 0 && len(m.m) > m.opts.MaxEntries) ||
+		(m.opts.MaxBytes > 0 && m.bytes > m.opts.MaxBytes)
+}
+
+func (m *Map[K, V]) evict() []Tuple[K, V] {
+	var evicted []Tuple[K, V]
+	for len(m.m) > 0 && m.over() {
+		k := m.policy.victim()
+		e := m.m[k]
+		delete(m.m, k)
+		m.bytes -= e.size
+		if m.opts.OnEvict != nil {
+			evicted = append(evicted, Tuple[K, V]{Key: k, Value: e.value})
+		}
+	}
+	return evicted
+}
+
+// Delete ...
+func (m *Map[K, V]) Delete(key K) {
+	m.mu.Lock()
+	if e, ok := m.m[key]; ok {
+		delete(m.m, key)
+		m.bytes -= e.size
+		m.policy.remove(key)
+	}
+	m.mu.Unlock()
+}
+
+// Len ...
+func (m *Map[K, V]) Len() int {
+	m.mu.Lock()
+	n := len(m.m)
+	m.mu.Unlock()
+	return n
+}
+
+// Bytes is the sum of Size over all the entries.
+func (m *Map[K, V]) Bytes() int64 {
+	m.mu.Lock()
+	n := m.bytes
+	m.mu.Unlock()
+	return n
+}
+
+// Tuple ...
+type Tuple[K comparable, V any] = cmap.Tuple[K, V]
+
+// Snapshot doesn't count as a use of the entries.
+func (m *Map[K, V]) Snapshot() map[K]V {
+
+	m.mu.Lock()
+	ret := make(map[K]V, len(m.m))
+	for k, e := range m.m {
+		ret[k] = e.value
+	}
+	m.mu.Unlock()
+	return ret
+}
+
+// SliceSnapshot doesn't count as a use of the entries.
+func (m *Map[K, V]) SliceSnapshot() []Tuple[K, V] {
+	i := 0
+	m.mu.Lock()
+	ret := make([]Tuple[K, V], len(m.m))
+	for k, e := range m.m {
+		ret[i] = Tuple[K, V]{Key: k, Value: e.value}
+		i++
+	}
+	m.mu.Unlock()
+	return ret
+}
+
+// Range calls f for every key and value until f returns false, like
+// sync.Map.Range. It walks a snapshot, so f is free to call back into the map.
+func (m *Map[K, V]) Range(f func(key K, value V) bool) {
+	for _, kv := range m.SliceSnapshot() {
+		if !f(kv.Key, kv.Value) {
+			return
+		}
+	}
+}
+
+// All to use with a range-over-func loop. The snapshot is taken when the loop
+// starts, and breaking out early leaves nothing behind.
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	return m.Range
+}
@@ -0,0 +1,177 @@
+package bounded
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+	"github.com/antoniomo/gobench/pkg/cmap/cmaptest"
+)
+
+var policies = []Policy{LRU, LFU, CLOCK}
+
+func TestConformance(t *testing.T) {
+	for _, p := range policies {
+		t.Run(p.String(), func(t *testing.T) {
+			// Big enough that the suite never triggers an eviction.
+			cmaptest.Run(t, func() cmap.Map[string, string] {
+				return New(Options[string, string]{Policy: p, MaxEntries: 1 << 20})
+			})
+		})
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	for _, p := range policies {
+		t.Run(p.String(), func(t *testing.T) {
+			var evicted []int
+			m := New(Options[int, int]{
+				Policy:     p,
+				MaxEntries: 10,
+				OnEvict:    func(k, v int) { evicted = append(evicted, k) },
+			})
+			for i := 0; i < 100; i++ {
+				m.Set(i, i)
+				if n := m.Len(); n > 10 {
+					t.Fatalf("Len() = %d after Set(%d); want at most 10", n, i)
+				}
+			}
+			if len(evicted) != 90 {
+				t.Fatalf("OnEvict called %d times; want 90", len(evicted))
+			}
+		})
+	}
+}
+
+func TestEvictionOrder(t *testing.T) {
+	for _, tc := range []struct {
+		policy Policy
+		want   int
+	}{
+		// 0, 1 and 2 are set, then 0 is read twice and 1 once.
+		{LRU, 2},   // 2 is the least recently used
+		{LFU, 2},   // 2 is the least frequently used
+		{CLOCK, 2}, // 0 and 1 have their reference bit set
+	} {
+		t.Run(tc.policy.String(), func(t *testing.T) {
+			var evicted []int
+			m := New(Options[int, int]{
+				Policy:     tc.policy,
+				MaxEntries: 3,
+				OnEvict:    func(k, v int) { evicted = append(evicted, k) },
+			})
+			m.Set(0, 0)
+			m.Set(1, 1)
+			m.Set(2, 2)
+			m.Get(0)
+			m.Get(1)
+			m.Get(0)
+			m.Set(3, 3)
+			if len(evicted) != 1 || evicted[0] != tc.want {
+				t.Fatalf("evicted %v; want [%d]", evicted, tc.want)
+			}
+		})
+	}
+}
+
+func TestLRUvsLFU(t *testing.T) {
+	// 0 is used a lot, long ago. LRU evicts it, LFU keeps it.
+	for _, tc := range []struct {
+		policy Policy
+		kept   bool
+	}{{LRU, false}, {LFU, true}} {
+		m := New(Options[int, int]{Policy: tc.policy, MaxEntries: 2})
+		m.Set(0, 0)
+		for i := 0; i < 10; i++ {
+			m.Get(0)
+		}
+		m.Set(1, 1)
+		m.Get(1)
+		m.Set(2, 2)
+		if _, ok := m.Get(0); ok != tc.kept {
+			t.Errorf("%v: Get(0) found = %v; want %v", tc.policy, ok, tc.kept)
+		}
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	m := New(Options[string, string]{
+		MaxBytes: 100,
+		Size:     func(k, v string) int64 { return int64(len(k) + len(v)) },
+	})
+	for i := 0; i < 100; i++ {
+		m.Set(strconv.Itoa(i), "0123456789")
+		if b := m.Bytes(); b > 100 {
+			t.Fatalf("Bytes() = %d; want at most 100", b)
+		}
+	}
+	m.Set("huge", string(make([]byte, 200)))
+	if n := m.Len(); n != 0 {
+		t.Fatalf("Len() = %d after an entry over the whole budget; want 0", n)
+	}
+}
+
+func TestDeleteAndOverwrite(t *testing.T) {
+	for _, p := range policies {
+		evictions := 0
+		m := New(Options[int, int]{
+			Policy:     p,
+			MaxEntries: 2,
+			OnEvict:    func(k, v int) { evictions++ },
+		})
+		m.Set(0, 0)
+		m.Set(0, 1) // overwrite, not a new entry
+		m.Set(1, 1)
+		m.Delete(0)
+		m.Set(2, 2)
+		if evictions != 0 || m.Len() != 2 {
+			t.Fatalf("%v: %d evictions, Len() = %d; want 0, 2", p, evictions, m.Len())
+		}
+		m.Set(3, 3)
+		if evictions != 1 {
+			t.Fatalf("%v: %d evictions; want 1", p, evictions)
+		}
+	}
+}
+
+func TestOnEvictCanReenter(t *testing.T) {
+	var m *Map[int, int]
+	m = New(Options[int, int]{
+		MaxEntries: 1,
+		OnEvict:    func(k, v int) { m.Get(k) },
+	})
+	m.Set(0, 0)
+	m.Set(1, 1) // deadlocks if OnEvict runs under the lock
+}
+
+// BenchmarkHitRatio reads Zipf distributed keys from a cache a tenth the size
+// of the key space, setting the key on every miss, and reports the hit ratio
+// of each policy.
+func BenchmarkHitRatio(b *testing.B) {
+	const (
+		keyspace = 100000
+		capacity = keyspace / 10
+	)
+	for _, s := range []float64{1.01, 1.2} {
+		for _, p := range policies {
+			b.Run(fmt.Sprintf("s=%v/%v", s, p), func(b *testing.B) {
+				m := New(Options[uint64, uint64]{Policy: p, MaxEntries: capacity})
+				z := rand.NewZipf(rand.New(rand.NewSource(1)), s, 1, keyspace-1)
+				hits := 0
+				b.ResetTimer()
+
+				for i := 0; i < b.N; i++ {
+					k := z.Uint64()
+					if _, ok := m.Get(k); ok {
+						hits++
+					} else {
+						m.Set(k, k)
+					}
+				}
+				b.ReportMetric(100*float64(hits)/float64(b.N), "hit%")
+			})
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package bounded
+
+import (
+	"container/heap"
+	"container/list"
+)
+
+// lru keeps the keys in a list, most recently used at the front.
+type lru[K comparable] struct {
+	l   *list.List
+	idx map[K]*list.Element
+}
+
+func newLRU[K comparable]() *lru[K] {
+	return &lru[K]{l: list.New(), idx: make(map[K]*list.Element)}
+}
+
+func (p *lru[K]) add(key K) {
+	p.idx[key] = p.l.PushFront(key)
+}
+
+func (p *lru[K]) touch(key K) {
+	p.l.MoveToFront(p.idx[key])
+}
+
+func (p *lru[K]) remove(key K) {
+	p.l.Remove(p.idx[key])
+	delete(p.idx, key)
+}
+
+func (p *lru[K]) victim() K {
+	key := p.l.Remove(p.l.Back()).(K)
+	delete(p.idx, key)
+	return key
+}
+
+// lfu keeps the keys in a min heap of use count, then last use.
+type lfu[K comparable] struct {
+	h    lfuHeap[K]
+	idx  map[K]*lfuItem[K]
+	tick uint64
+}
+
+type lfuItem[K comparable] struct {
+	key   K
+	count uint64
+	last  uint64
+	index int
+}
+
+type lfuHeap[K comparable] []*lfuItem[K]
+
+func (h lfuHeap[K]) Len() int { return len(h) }
+
+func (h lfuHeap[K]) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].last < h[j].last
+}
+
+func (h lfuHeap[K]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap[K]) Push(x any) {
+	it := x.(*lfuItem[K])
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *lfuHeap[K]) Pop() any {
+	old := *h
+	it := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return it
+}
+
+func newLFU[K comparable]() *lfu[K] {
+	return &lfu[K]{idx: make(map[K]*lfuItem[K])}
+}
+
+func (p *lfu[K]) add(key K) {
+	p.tick++
+	it := &lfuItem[K]{key: key, count: 1, last: p.tick}
+	p.idx[key] = it
+	heap.Push(&p.h, it)
+}
+
+func (p *lfu[K]) touch(key K) {
+	p.tick++
+	it := p.idx[key]
+	it.count++
+	it.last = p.tick
+	heap.Fix(&p.h, it.index)
+}
+
+func (p *lfu[K]) remove(key K) {
+	heap.Remove(&p.h, p.idx[key].index)
+	delete(p.idx, key)
+}
+
+func (p *lfu[K]) victim() K {
+	it := heap.Pop(&p.h).(*lfuItem[K])
+	delete(p.idx, it.key)
+	return it.key
+}
+
+// clock keeps the keys in a ring with a reference bit each. The hand clears
+// the bits it passes over and evicts the first key whose bit is already
+// clear. Removed keys leave a hole that add reuses.
+type clock[K comparable] struct {
+	slots []clockSlot[K]
+	idx   map[K]int
+	free  []int
+	hand  int
+}
+
+type clockSlot[K comparable] struct {
+	key  K
+	used bool // slot holds a key
+	ref  bool
+}
+
+func newClock[K comparable]() *clock[K] {
+	return &clock[K]{idx: make(map[K]int)}
+}
+
+func (p *clock[K]) add(key K) {
+	s := clockSlot[K]{key: key, used: true}
+	if n := len(p.free); n > 0 {
+		i := p.free[n-1]
+		p.free = p.free[:n-1]
+		p.slots[i] = s
+		p.idx[key] = i
+		return
+	}
+	p.slots = append(p.slots, s)
+	p.idx[key] = len(p.slots) - 1
+}
+
+func (p *clock[K]) touch(key K) {
+	p.slots[p.idx[key]].ref = true
+}
+
+func (p *clock[K]) remove(key K) {
+	i := p.idx[key]
+	p.slots[i] = clockSlot[K]{}
+	p.free = append(p.free, i)
+	delete(p.idx, key)
+}
+
+func (p *clock[K]) victim() K {
+	for {
+		if p.hand >= len(p.slots) {
+			p.hand = 0
+		}
+		s := &p.slots[p.hand]
+		p.hand++
+		switch {
+		case !s.used:
+		case s.ref:
+			s.ref = false
+		default:
+			key := s.key
+			p.remove(key)
+			return key
+		}
+	}
+}
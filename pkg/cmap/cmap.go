@@ -0,0 +1,41 @@
+package cmap
+
+import "iter"
+
+// Map is the set of operations shared by the concurrent maps in pkg/, so they
+// can be tested and benchmarked interchangeably. Implementations must be safe
+// for concurrent use.
+type Map[K comparable, V any] interface {
+	Get(key K) (V, bool)
+	Set(key K, value V)
+	Delete(key K)
+	// All to use with a range-over-func loop. Breaking out early must be safe.
+	All() iter.Seq2[K, V]
+	// Snapshot returns a point in time copy that later writes don't affect.
+	Snapshot() map[K]V
+}
+
+// Tuple ...
+type Tuple[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// Result is what Get returns, for the bulk GetMany.
+type Result[V any] struct {
+	Value V
+	Ok    bool
+}
+
+// AtomicMap adds the sync.Map style check-then-act operations, each of which
+// must happen atomically with respect to other writers.
+type AtomicMap[K comparable, V any] interface {
+	Map[K, V]
+	LoadOrStore(key K, value V) (actual V, loaded bool)
+	LoadAndDelete(key K) (value V, loaded bool)
+	Swap(key K, value V) (previous V, loaded bool)
+	CompareAndSwap(key K, old, new V) (swapped bool)
+	CompareAndDelete(key K, old V) (deleted bool)
+	// Update stores what f returns for key, or deletes it if f returns false.
+	Update(key K, f func(old V, ok bool) (V, bool)) (V, bool)
+}
@@ -0,0 +1,134 @@
+package cmaptest
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+)
+
+// RunAtomic runs the suite for the check-then-act operations of
+// cmap.AtomicMap. It doesn't include Run.
+func RunAtomic(t *testing.T, newMap func() cmap.AtomicMap[string, int]) {
+	t.Run("LoadOrStore", func(t *testing.T) { testLoadOrStore(t, newMap()) })
+	t.Run("LoadAndDelete", func(t *testing.T) { testLoadAndDelete(t, newMap()) })
+	t.Run("Swap", func(t *testing.T) { testSwap(t, newMap()) })
+	t.Run("CompareAndSwap", func(t *testing.T) { testCompareAndSwap(t, newMap()) })
+	t.Run("CompareAndDelete", func(t *testing.T) { testCompareAndDelete(t, newMap()) })
+	t.Run("Update", func(t *testing.T) { testUpdate(t, newMap()) })
+	t.Run("ConcurrentCounters", func(t *testing.T) { testConcurrentCounters(t, newMap()) })
+}
+
+func testLoadOrStore(t *testing.T, m cmap.AtomicMap[string, int]) {
+	if v, loaded := m.LoadOrStore("k", 1); loaded || v != 1 {
+		t.Fatalf("LoadOrStore on a missing key = %d, %v; want 1, false", v, loaded)
+	}
+	if v, loaded := m.LoadOrStore("k", 2); !loaded || v != 1 {
+		t.Fatalf("LoadOrStore on an existing key = %d, %v; want 1, true", v, loaded)
+	}
+}
+
+func testLoadAndDelete(t *testing.T, m cmap.AtomicMap[string, int]) {
+	if _, loaded := m.LoadAndDelete("k"); loaded {
+		t.Fatal("LoadAndDelete loaded a missing key")
+	}
+	m.Set("k", 1)
+	if v, loaded := m.LoadAndDelete("k"); !loaded || v != 1 {
+		t.Fatalf("LoadAndDelete = %d, %v; want 1, true", v, loaded)
+	}
+	if _, ok := m.Get("k"); ok {
+		t.Fatal("LoadAndDelete didn't delete")
+	}
+}
+
+func testSwap(t *testing.T, m cmap.AtomicMap[string, int]) {
+	if _, loaded := m.Swap("k", 1); loaded {
+		t.Fatal("Swap loaded a missing key")
+	}
+	if v, loaded := m.Swap("k", 2); !loaded || v != 1 {
+		t.Fatalf("Swap = %d, %v; want 1, true", v, loaded)
+	}
+	if v, _ := m.Get("k"); v != 2 {
+		t.Fatalf("Get after Swap = %d; want 2", v)
+	}
+}
+
+func testCompareAndSwap(t *testing.T, m cmap.AtomicMap[string, int]) {
+	if m.CompareAndSwap("k", 0, 1) {
+		t.Fatal("CompareAndSwap swapped a missing key")
+	}
+	m.Set("k", 1)
+	if m.CompareAndSwap("k", 2, 3) {
+		t.Fatal("CompareAndSwap swapped a mismatched value")
+	}
+	if !m.CompareAndSwap("k", 1, 3) {
+		t.Fatal("CompareAndSwap didn't swap a matching value")
+	}
+	if v, _ := m.Get("k"); v != 3 {
+		t.Fatalf("Get after CompareAndSwap = %d; want 3", v)
+	}
+}
+
+func testCompareAndDelete(t *testing.T, m cmap.AtomicMap[string, int]) {
+	m.Set("k", 1)
+	if m.CompareAndDelete("k", 2) {
+		t.Fatal("CompareAndDelete deleted a mismatched value")
+	}
+	if !m.CompareAndDelete("k", 1) {
+		t.Fatal("CompareAndDelete didn't delete a matching value")
+	}
+	if _, ok := m.Get("k"); ok {
+		t.Fatal("CompareAndDelete left the key behind")
+	}
+}
+
+func testUpdate(t *testing.T, m cmap.AtomicMap[string, int]) {
+	inc := func(old int, ok bool) (int, bool) { return old + 1, true }
+	if v, ok := m.Update("k", inc); !ok || v != 1 {
+		t.Fatalf("Update on a missing key = %d, %v; want 1, true", v, ok)
+	}
+	if v, ok := m.Update("k", inc); !ok || v != 2 {
+		t.Fatalf("Update = %d, %v; want 2, true", v, ok)
+	}
+	m.Update("k", func(old int, ok bool) (int, bool) { return 0, false })
+	if _, ok := m.Get("k"); ok {
+		t.Fatal("Update returning false didn't delete")
+	}
+}
+
+// testConcurrentCounters loses increments if the read and the write of any of
+// the operations aren't atomic.
+func testConcurrentCounters(t *testing.T, m cmap.AtomicMap[string, int]) {
+	const keys = 4
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < testelements; i++ {
+				k := strconv.Itoa(i % keys)
+				if i%2 == 0 {
+					m.Update(k, func(old int, ok bool) (int, bool) { return old + 1, true })
+					continue
+				}
+				for {
+					old, loaded := m.LoadOrStore(k, 1)
+					if !loaded || m.CompareAndSwap(k, old, old+1) {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for k := 0; k < keys; k++ {
+		v, _ := m.Get(strconv.Itoa(k))
+		total += v
+	}
+	if total != workers*testelements {
+		t.Fatalf("counters add up to %d; want %d", total, workers*testelements)
+	}
+}
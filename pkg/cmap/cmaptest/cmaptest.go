@@ -0,0 +1,181 @@
+// Package cmaptest is a conformance suite for cmap.Map implementations. Every
+// map package runs it from its own tests so that all the variants are held to
+// the same semantics. Run it with -race to also check the concurrent cases.
+package cmaptest
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+)
+
+const (
+	testelements = 1000
+	workers      = 8
+)
+
+// Run runs the whole suite, calling newMap to get a fresh, empty map for each
+// subtest. The semantics checked don't depend on the key and value types, so
+// the suite works on the string/string instantiation.
+func Run(t *testing.T, newMap func() cmap.Map[string, string]) {
+	t.Run("GetMissing", func(t *testing.T) { testGetMissing(t, newMap()) })
+	t.Run("GetAfterSet", func(t *testing.T) { testGetAfterSet(t, newMap()) })
+	t.Run("Overwrite", func(t *testing.T) { testOverwrite(t, newMap()) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, newMap()) })
+	t.Run("SnapshotIsolation", func(t *testing.T) { testSnapshotIsolation(t, newMap()) })
+	t.Run("IterCompleteness", func(t *testing.T) { testIterCompleteness(t, newMap()) })
+	t.Run("IterBreak", func(t *testing.T) { testIterBreak(t, newMap()) })
+	t.Run("Concurrent", func(t *testing.T) { testConcurrent(t, newMap()) })
+}
+
+func testGetMissing(t *testing.T, m cmap.Map[string, string]) {
+	if v, ok := m.Get("missing"); ok || v != "" {
+		t.Fatalf("Get(missing) = %q, %v; want \"\", false", v, ok)
+	}
+}
+
+func testGetAfterSet(t *testing.T, m cmap.Map[string, string]) {
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), "v"+strconv.Itoa(i))
+	}
+	for i := 0; i < testelements; i++ {
+		k := strconv.Itoa(i)
+		if v, ok := m.Get(k); !ok || v != "v"+k {
+			t.Fatalf("Get(%q) = %q, %v; want %q, true", k, v, ok, "v"+k)
+		}
+	}
+}
+
+func testOverwrite(t *testing.T, m cmap.Map[string, string]) {
+	m.Set("k", "old")
+	m.Set("k", "new")
+	if v, ok := m.Get("k"); !ok || v != "new" {
+		t.Fatalf("Get(k) = %q, %v; want \"new\", true", v, ok)
+	}
+	if n := len(m.Snapshot()); n != 1 {
+		t.Fatalf("len(Snapshot()) = %d; want 1", n)
+	}
+}
+
+func testDelete(t *testing.T, m cmap.Map[string, string]) {
+	m.Set("a", "1")
+	m.Set("b", "2")
+	m.Delete("a")
+	m.Delete("missing") // must be a no-op
+	if _, ok := m.Get("a"); ok {
+		t.Fatal("Get(a) found a deleted key")
+	}
+	if v, ok := m.Get("b"); !ok || v != "2" {
+		t.Fatalf("Get(b) = %q, %v; want \"2\", true", v, ok)
+	}
+	m.Set("a", "3")
+	if v, ok := m.Get("a"); !ok || v != "3" {
+		t.Fatalf("Get(a) after re-Set = %q, %v; want \"3\", true", v, ok)
+	}
+}
+
+func testSnapshotIsolation(t *testing.T, m cmap.Map[string, string]) {
+	m.Set("kept", "1")
+	m.Set("changed", "1")
+	m.Set("deleted", "1")
+
+	snap := m.Snapshot()
+	m.Set("changed", "2")
+	m.Set("added", "1")
+	m.Delete("deleted")
+
+	want := map[string]string{"kept": "1", "changed": "1", "deleted": "1"}
+	if len(snap) != len(want) {
+		t.Fatalf("snapshot changed after writes: got %v; want %v", snap, want)
+	}
+	for k, v := range want {
+		if snap[k] != v {
+			t.Fatalf("snapshot changed after writes: got %v; want %v", snap, want)
+		}
+	}
+}
+
+func testIterCompleteness(t *testing.T, m cmap.Map[string, string]) {
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), strconv.Itoa(i))
+	}
+	seen := make(map[string]bool, testelements)
+	for k, v := range m.All() {
+		if seen[k] {
+			t.Fatalf("All yielded %q twice", k)
+		}
+		if k != v {
+			t.Fatalf("All yielded %q = %q; want %q", k, v, k)
+		}
+		seen[k] = true
+	}
+	if len(seen) != testelements {
+		t.Fatalf("All yielded %d keys; want %d", len(seen), testelements)
+	}
+}
+
+// testIterBreak also writes from inside the loop, which deadlocks if All holds
+// the map lock while yielding.
+func testIterBreak(t *testing.T, m cmap.Map[string, string]) {
+	for i := 0; i < testelements; i++ {
+		m.Set(strconv.Itoa(i), strconv.Itoa(i))
+	}
+	n := 0
+	for k := range m.All() {
+		m.Set(k, "seen")
+		n++
+		if n == 10 {
+			break
+		}
+	}
+	if n != 10 {
+		t.Fatalf("got %d iterations before break; want 10", n)
+	}
+}
+
+// testConcurrent has every worker own a disjoint key range, so the final state
+// is deterministic while readers and iterators run alongside the writers.
+func testConcurrent(t *testing.T, m cmap.Map[string, string]) {
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < testelements; i++ {
+				k := strconv.Itoa(w*testelements + i)
+				m.Set(k, k)
+				if v, ok := m.Get(k); !ok || v != k {
+					t.Errorf("Get(%q) = %q, %v; want %q, true", k, v, ok, k)
+					return
+				}
+				if i%2 == 1 {
+					m.Delete(k)
+				}
+			}
+		}(w)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				for k, v := range m.All() {
+					_, _ = k, v
+				}
+				_ = m.Snapshot()
+			}
+		}()
+	}
+	wg.Wait()
+
+	snap := m.Snapshot()
+	if len(snap) != workers*testelements/2 {
+		t.Fatalf("len(Snapshot()) = %d; want %d", len(snap), workers*testelements/2)
+	}
+	for k, v := range snap {
+		i, err := strconv.Atoi(k)
+		if err != nil || i%2 == 1 || v != k {
+			t.Fatalf("unexpected entry %q = %q", k, v)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package cmaptest
+
+import (
+	"testing"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+)
+
+// RunVersioned checks that versions go up with writes, and only with writes
+// that change the map, and that they're consistent with the snapshot they
+// come with. It doesn't include Run.
+func RunVersioned(t *testing.T, newMap func() cmap.VersionedMap[string, string]) {
+	m := newMap()
+	v0 := m.VersionedSnapshot()
+	if again := m.VersionedSnapshot(); again.Version != v0.Version {
+		t.Fatalf("version moved from %d to %d without writes", v0.Version, again.Version)
+	}
+
+	m.Set("a", "1")
+	v1 := m.VersionedSnapshot()
+	m.Set("b", "1")
+	m.Set("a", "2")
+	m.Delete("b")
+	m.Set("c", "1")
+	v2 := m.VersionedSnapshot()
+	if !(v0.Version < v1.Version && v1.Version < v2.Version) {
+		t.Fatalf("versions %d, %d, %d don't go up with writes", v0.Version, v1.Version, v2.Version)
+	}
+
+	d := cmap.Diff(v1, v2)
+	if len(d.Added) != 1 || d.Added["c"] != "1" ||
+		len(d.Removed) != 0 ||
+		len(d.Changed) != 1 || d.Changed["a"] != (cmap.Change[string]{Old: "1", New: "2"}) {
+		t.Fatalf("Diff(v1, v2) = %+v; want c added and a changed from 1 to 2", d)
+	}
+	if len(v1.Map) != 1 || v1.Map["a"] != "1" {
+		t.Fatalf("v1 changed after later writes: %v", v1.Map)
+	}
+
+	m.Delete("missing")
+	if v3 := m.VersionedSnapshot(); v3.Version != v2.Version {
+		t.Fatalf("version moved from %d to %d deleting a missing key", v2.Version, v3.Version)
+	}
+}
@@ -0,0 +1,78 @@
+package cmap
+
+// Versioned is a snapshot tagged with the version of the map it was taken
+// from. Versions only mean something between snapshots of the same map: they
+// go up with every write that changes it, so equal versions mean equal
+// contents, and a write that changes nothing, like deleting a missing key,
+// leaves the version as it was.
+type Versioned[K comparable, V any] struct {
+	Version uint64
+	Map     map[K]V
+}
+
+// VersionedMap is a Map that can take versioned snapshots.
+type VersionedMap[K comparable, V any] interface {
+	Map[K, V]
+	VersionedSnapshot() Versioned[K, V]
+}
+
+// Change is the before and after of a changed key.
+type Change[V any] struct {
+	Old V
+	New V
+}
+
+// Delta is what changed between two snapshots.
+type Delta[K comparable, V any] struct {
+	Added   map[K]V         // with their new values
+	Removed map[K]V         // with their old values
+	Changed map[K]Change[V] // only keys whose value is different
+}
+
+// Empty tells if nothing changed.
+func (d Delta[K, V]) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Diff compares two snapshots of the same map. When the versions match it
+// returns right away without looking at the contents.
+func Diff[K comparable, V comparable](old, new Versioned[K, V]) Delta[K, V] {
+	return DiffFunc(old, new, func(a, b V) bool { return a == b })
+}
+
+// DiffFunc is Diff for values that aren't comparable with ==.
+func DiffFunc[K comparable, V any](old, new Versioned[K, V], equal func(a, b V) bool) Delta[K, V] {
+	if old.Version == new.Version {
+		return Delta[K, V]{}
+	}
+	return DiffMaps(old.Map, new.Map, equal)
+}
+
+// DiffMaps compares two plain maps, key by key.
+func DiffMaps[K comparable, V any](old, new map[K]V, equal func(a, b V) bool) Delta[K, V] {
+	var d Delta[K, V]
+	for k, nv := range new {
+		ov, ok := old[k]
+		switch {
+		case !ok:
+			if d.Added == nil {
+				d.Added = make(map[K]V)
+			}
+			d.Added[k] = nv
+		case !equal(ov, nv):
+			if d.Changed == nil {
+				d.Changed = make(map[K]Change[V])
+			}
+			d.Changed[k] = Change[V]{Old: ov, New: nv}
+		}
+	}
+	for k, ov := range old {
+		if _, ok := new[k]; !ok {
+			if d.Removed == nil {
+				d.Removed = make(map[K]V)
+			}
+			d.Removed[k] = ov
+		}
+	}
+	return d
+}
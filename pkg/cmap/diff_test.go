@@ -0,0 +1,44 @@
+package cmap_test
+
+import (
+	"testing"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+)
+
+func TestDiff(t *testing.T) {
+	old := cmap.Versioned[string, int]{Version: 1, Map: map[string]int{"same": 1, "changed": 1, "removed": 1}}
+	new := cmap.Versioned[string, int]{Version: 2, Map: map[string]int{"same": 1, "changed": 2, "added": 1}}
+
+	d := cmap.Diff(old, new)
+	if len(d.Added) != 1 || d.Added["added"] != 1 {
+		t.Errorf("Added = %v; want map[added:1]", d.Added)
+	}
+	if len(d.Removed) != 1 || d.Removed["removed"] != 1 {
+		t.Errorf("Removed = %v; want map[removed:1]", d.Removed)
+	}
+	if len(d.Changed) != 1 || d.Changed["changed"] != (cmap.Change[int]{Old: 1, New: 2}) {
+		t.Errorf("Changed = %v; want map[changed:{1 2}]", d.Changed)
+	}
+	if d.Empty() {
+		t.Error("Empty() = true")
+	}
+}
+
+func TestDiffSameVersion(t *testing.T) {
+	// Same version means same contents, so the maps aren't even looked at.
+	old := cmap.Versioned[string, int]{Version: 7, Map: map[string]int{"a": 1}}
+	new := cmap.Versioned[string, int]{Version: 7, Map: map[string]int{"b": 1}}
+	if d := cmap.Diff(old, new); !d.Empty() {
+		t.Fatalf("Diff of equal versions = %+v; want empty", d)
+	}
+}
+
+func TestDiffFunc(t *testing.T) {
+	old := cmap.Versioned[string, []int]{Version: 1, Map: map[string][]int{"a": {1}, "b": {1}}}
+	new := cmap.Versioned[string, []int]{Version: 2, Map: map[string][]int{"a": {1}, "b": {2}}}
+	d := cmap.DiffFunc(old, new, func(a, b []int) bool { return a[0] == b[0] })
+	if len(d.Changed) != 1 || len(d.Added) != 0 || len(d.Removed) != 0 {
+		t.Fatalf("DiffFunc = %+v; want only b changed", d)
+	}
+}
@@ -0,0 +1,142 @@
+package cmap
+
+import (
+	"iter"
+	"sync"
+)
+
+// SyncMap adapts a sync.Map to the Map interface.
+type SyncMap[K comparable, V any] struct {
+	m sync.Map
+}
+
+// NewSyncMap ...
+func NewSyncMap[K comparable, V any]() *SyncMap[K, V] {
+	return &SyncMap[K, V]{}
+}
+
+// Get ...
+func (m *SyncMap[K, V]) Get(key K) (V, bool) {
+	value, ok := m.m.Load(key)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return value.(V), true
+}
+
+// Set ...
+func (m *SyncMap[K, V]) Set(key K, value V) {
+	m.m.Store(key, value)
+}
+
+// Delete ...
+func (m *SyncMap[K, V]) Delete(key K) {
+	m.m.Delete(key)
+}
+
+// Iter to use with a range loop
+//
+// Deprecated: use All.
+func (m *SyncMap[K, V]) Iter() <-chan Tuple[K, V] {
+
+	snap := m.Snapshot()
+	// Fully buffered, trade memory for speed baby!
+	ret := make(chan Tuple[K, V], len(snap))
+	go func() {
+		for k, v := range snap {
+			ret <- Tuple[K, V]{k, v}
+		}
+		close(ret)
+	}()
+	return ret
+}
+
+// Snapshot ...
+func (m *SyncMap[K, V]) Snapshot() map[K]V {
+
+	ret := make(map[K]V)
+	m.m.Range(func(k, v interface{}) bool {
+		ret[k.(K)] = v.(V)
+		return true
+	})
+	return ret
+}
+
+// Range ...
+func (m *SyncMap[K, V]) Range(f func(key K, value V) bool) {
+	m.m.Range(func(k, v interface{}) bool {
+		return f(k.(K), v.(V))
+	})
+}
+
+// All ...
+func (m *SyncMap[K, V]) All() iter.Seq2[K, V] {
+	return m.Range
+}
+
+// LoadOrStore ...
+func (m *SyncMap[K, V]) LoadOrStore(key K, value V) (V, bool) {
+	actual, loaded := m.m.LoadOrStore(key, value)
+	return actual.(V), loaded
+}
+
+// LoadAndDelete ...
+func (m *SyncMap[K, V]) LoadAndDelete(key K) (V, bool) {
+	value, loaded := m.m.LoadAndDelete(key)
+	if !loaded {
+		var zero V
+		return zero, false
+	}
+	return value.(V), true
+}
+
+// Swap ...
+func (m *SyncMap[K, V]) Swap(key K, value V) (V, bool) {
+	previous, loaded := m.m.Swap(key, value)
+	if !loaded {
+		var zero V
+		return zero, false
+	}
+	return previous.(V), true
+}
+
+// CompareAndSwap ...
+func (m *SyncMap[K, V]) CompareAndSwap(key K, old, new V) bool {
+	return m.m.CompareAndSwap(key, old, new)
+}
+
+// CompareAndDelete ...
+func (m *SyncMap[K, V]) CompareAndDelete(key K, old V) bool {
+	return m.m.CompareAndDelete(key, old)
+}
+
+// Update is a compare and swap loop, as sync.Map has no lock to hold across
+// the read and the write. f may be called more than once, and V must be
+// comparable at run time.
+func (m *SyncMap[K, V]) Update(key K, f func(old V, ok bool) (V, bool)) (V, bool) {
+	for {
+		var oldV V
+		old, ok := m.m.Load(key)
+		if ok {
+			oldV = old.(V)
+		}
+		value, keep := f(oldV, ok)
+		switch {
+		case keep && ok:
+			if m.m.CompareAndSwap(key, old, value) {
+				return value, true
+			}
+		case keep:
+			if _, loaded := m.m.LoadOrStore(key, value); !loaded {
+				return value, true
+			}
+		case ok:
+			if m.m.CompareAndDelete(key, old) {
+				return value, false
+			}
+		default:
+			return value, false
+		}
+	}
+}
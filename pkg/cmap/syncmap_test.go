@@ -0,0 +1,20 @@
+package cmap_test
+
+import (
+	"testing"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+	"github.com/antoniomo/gobench/pkg/cmap/cmaptest"
+)
+
+func TestSyncMapConformance(t *testing.T) {
+	cmaptest.Run(t, func() cmap.Map[string, string] {
+		return cmap.NewSyncMap[string, string]()
+	})
+}
+
+func TestSyncMapAtomicConformance(t *testing.T) {
+	cmaptest.RunAtomic(t, func() cmap.AtomicMap[string, int] {
+		return cmap.NewSyncMap[string, int]()
+	})
+}
@@ -0,0 +1,279 @@
+// Package codec is a compact binary snapshot format for the maps in pkg/.
+//
+// A snapshot is a header, the entries, and a CRC-32C of everything before it:
+//
+//	magic "GBSN" | format version | key id | value id | uvarint count
+//	count × (key, value)
+//	little endian uint32 CRC-32C
+//
+// Strings and byte slices are uvarint length prefixed, integers are varints,
+// and [16]byte keys (UUIDs) are written as is. Other types fall back to gob.
+package codec
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"iter"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Version is the format version written by Encode.
+const Version = 1
+
+var magic = [4]byte{'G', 'B', 'S', 'N'}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Errors returned by Decode. Truncated input returns io.ErrUnexpectedEOF.
+var (
+	ErrMagic    = errors.New("codec: not a snapshot")
+	ErrVersion  = errors.New("codec: unsupported format version")
+	ErrTypes    = errors.New("codec: snapshot has different key or value types")
+	ErrChecksum = errors.New("codec: checksum mismatch")
+	ErrCorrupt  = errors.New("codec: corrupt snapshot")
+)
+
+// Encode writes a snapshot of the n entries yielded by seq.
+func Encode[K comparable, V any](w io.Writer, n int, seq iter.Seq2[K, V]) (int64, error) {
+	ke, ve := elemFor[K](), elemFor[V]()
+	bw := bufio.NewWriter(w)
+	var (
+		crc     uint32
+		written int64
+		err     error
+	)
+	write := func(b []byte) {
+		if err != nil {
+			return
+		}
+		crc = crc32.Update(crc, castagnoli, b)
+		var nn int
+		nn, err = bw.Write(b)
+		written += int64(nn)
+	}
+
+	buf := append(magic[:0:0], magic[:]...)
+	buf = append(buf, Version, ke.id, ve.id)
+	buf = binary.AppendUvarint(buf, uint64(n))
+	write(buf)
+
+	count := 0
+	for k, v := range seq {
+		buf = buf[:0]
+		if buf, err = ke.append(buf, k); err != nil {
+			return written, err
+		}
+		if buf, err = ve.append(buf, v); err != nil {
+			return written, err
+		}
+		write(buf)
+		if err != nil {
+			return written, err
+		}
+		count++
+	}
+	if count != n {
+		return written, fmt.Errorf("codec: told %d entries, got %d", n, count)
+	}
+
+	buf = binary.LittleEndian.AppendUint32(buf[:0], crc)
+	nn, err := bw.Write(buf)
+	written += int64(nn)
+	if err != nil {
+		return written, err
+	}
+	return written, bw.Flush()
+}
+
+// Decode reads a whole snapshot into a new map. Nothing is returned unless
+// the checksum matches, so callers can swap the result in without ever
+// exposing half a snapshot.
+//
+// Decode buffers its reads, so it may consume bytes of r past the snapshot.
+func Decode[K comparable, V any](r io.Reader) (map[K]V, int64, error) {
+	ke, ve := elemFor[K](), elemFor[V]()
+	rd := &reader{br: bufio.NewReader(r)}
+
+	hdr, err := rd.readN(len(magic) + 3)
+	if err != nil {
+		return nil, rd.n, err
+	}
+	switch {
+	case [4]byte(hdr[:4]) != magic:
+		return nil, rd.n, ErrMagic
+	case hdr[4] != Version:
+		return nil, rd.n, fmt.Errorf("%w %d", ErrVersion, hdr[4])
+	case hdr[5] != ke.id || hdr[6] != ve.id:
+		return nil, rd.n, ErrTypes
+	}
+	count, err := binary.ReadUvarint(rd)
+	if err != nil {
+		return nil, rd.n, unexpected(err)
+	}
+	if count > maxLen {
+		return nil, rd.n, ErrCorrupt
+	}
+
+	ret := make(map[K]V, min(count, 1<<20))
+	for i := uint64(0); i < count; i++ {
+		k, err := ke.read(rd)
+		if err != nil {
+			return nil, rd.n, unexpected(err)
+		}
+		v, err := ve.read(rd)
+		if err != nil {
+			return nil, rd.n, unexpected(err)
+		}
+		ret[k] = v
+	}
+
+	want := rd.crc
+	sum, err := rd.readN(4)
+	if err != nil {
+		return nil, rd.n, err
+	}
+	if binary.LittleEndian.Uint32(sum) != want {
+		return nil, rd.n, ErrChecksum
+	}
+	return ret, rd.n, nil
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// reader counts and checksums everything read through it.
+type reader struct {
+	br interface {
+		io.Reader
+		io.ByteReader
+	}
+	crc uint32
+	n   int64
+	buf []byte
+}
+
+func (r *reader) ReadByte() (byte, error) {
+	c, err := r.br.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	r.buf = append(r.buf[:0], c)
+	r.crc = crc32.Update(r.crc, castagnoli, r.buf)
+	r.n++
+	return c, nil
+}
+
+// readN returns the next n bytes, valid until the next read.
+func (r *reader) readN(n int) ([]byte, error) {
+	if cap(r.buf) < n {
+		r.buf = make([]byte, n)
+	}
+	r.buf = r.buf[:n]
+	nn, err := io.ReadFull(r.br, r.buf)
+	r.n += int64(nn)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	r.crc = crc32.Update(r.crc, castagnoli, r.buf)
+	return r.buf, nil
+}
+
+// readLen reads a uvarint length prefixed chunk, valid until the next read.
+func (r *reader) readLen() ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	if n > maxLen {
+		return nil, ErrCorrupt
+	}
+	return r.readN(int(n))
+}
+
+// SaveFile writes w to path atomically: to a temporary file in the same
+// directory first, synced, then renamed over path. Readers of path see either
+// the old contents or the new ones, even if we crash half way.
+//
+// The file keeps the mode of the one it replaces. A new one gets 0644, less
+// the umask, as with os.Create.
+func SaveFile(path string, w io.WriterTo) (err error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := createTemp(dir, base)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if _, err = w.WriteTo(f); err != nil {
+		return err
+	}
+	if fi, serr := os.Stat(path); serr == nil {
+		if err = f.Chmod(fi.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// createTemp is os.CreateTemp, but with the umask applied to 0644 rather than
+// a plain 0600, for files that will be renamed into place.
+func createTemp(dir, base string) (*os.File, error) {
+	for range 10000 {
+		name := filepath.Join(dir, base+".tmp"+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		return f, err
+	}
+	return nil, fmt.Errorf("codec: no free temporary name for %s in %s", base, dir)
+}
+
+// syncDir makes a rename in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// LoadFile reads path into r.
+func LoadFile(path string, r io.ReaderFrom) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = r.ReadFrom(f)
+	return err
+}
@@ -0,0 +1,219 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func roundTrip[K comparable, V any](t *testing.T, m map[K]V) map[K]V {
+	t.Helper()
+	var buf bytes.Buffer
+	n, err := Encode(&buf, len(m), maps.All(m))
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Fatalf("Encode returned %d; wrote %d bytes", n, buf.Len())
+	}
+	got, rn, err := Decode[K, V](&buf)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if rn != n {
+		t.Fatalf("Decode read %d bytes; Encode wrote %d", rn, n)
+	}
+	if len(got) != len(m) {
+		t.Fatalf("decoded %d entries; want %d", len(got), len(m))
+	}
+	return got
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Run("string", func(t *testing.T) {
+		m := map[string]string{"": "", "a": "1", "héllo": string(make([]byte, 1000))}
+		if got := roundTrip(t, m); !maps.Equal(got, m) {
+			t.Fatalf("got %v; want %v", got, m)
+		}
+	})
+	t.Run("int", func(t *testing.T) {
+		m := map[int]int64{0: -1, -1 << 40: 1 << 62, 1: 0}
+		if got := roundTrip(t, m); !maps.Equal(got, m) {
+			t.Fatalf("got %v; want %v", got, m)
+		}
+	})
+	t.Run("uuid", func(t *testing.T) {
+		m := map[[16]byte]uint32{{1, 2, 3}: 7, {15: 0xff}: 1 << 31}
+		if got := roundTrip(t, m); !maps.Equal(got, m) {
+			t.Fatalf("got %v; want %v", got, m)
+		}
+	})
+	t.Run("bytes", func(t *testing.T) {
+		m := map[uint64][]byte{1: []byte("one"), 2: nil}
+		got := roundTrip(t, m)
+		for k, v := range m {
+			if !bytes.Equal(got[k], v) {
+				t.Fatalf("got[%d] = %q; want %q", k, got[k], v)
+			}
+		}
+	})
+	t.Run("gob", func(t *testing.T) {
+		type point struct{ X, Y int }
+		m := map[string]point{"a": {1, 2}, "b": {3, 4}, "c": {}}
+		if got := roundTrip(t, m); !maps.Equal(got, m) {
+			t.Fatalf("got %v; want %v", got, m)
+		}
+	})
+	t.Run("empty", func(t *testing.T) {
+		roundTrip(t, map[string]bool{})
+	})
+}
+
+func encoded(t *testing.T) []byte {
+	t.Helper()
+	m := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		m[strconv.Itoa(i)] = strconv.Itoa(i * i)
+	}
+	var buf bytes.Buffer
+	if _, err := Encode(&buf, len(m), maps.All(m)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCorruption(t *testing.T) {
+	b := encoded(t)
+	for i := range b {
+		c := bytes.Clone(b)
+		c[i] ^= 0x40
+		if m, _, err := Decode[string, string](bytes.NewReader(c)); err == nil {
+			t.Fatalf("flipping a bit of byte %d went unnoticed, got %d entries", i, len(m))
+		}
+	}
+}
+
+func TestTruncation(t *testing.T) {
+	b := encoded(t)
+	for i := 0; i < len(b); i++ {
+		_, _, err := Decode[string, string](bytes.NewReader(b[:i]))
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("truncated to %d bytes: got %v; want io.ErrUnexpectedEOF", i, err)
+		}
+	}
+}
+
+func TestHeaderErrors(t *testing.T) {
+	b := encoded(t)
+	if _, _, err := Decode[string, int](bytes.NewReader(b)); err != ErrTypes {
+		t.Errorf("wrong value type: got %v; want ErrTypes", err)
+	}
+	c := bytes.Clone(b)
+	c[4] = Version + 1
+	if _, _, err := Decode[string, string](bytes.NewReader(c)); !errors.Is(err, ErrVersion) {
+		t.Errorf("newer version: got %v; want ErrVersion", err)
+	}
+	if _, _, err := Decode[string, string](bytes.NewReader([]byte("{\"a\":\"1\"}"))); err != ErrMagic {
+		t.Errorf("JSON: got %v; want ErrMagic", err)
+	}
+}
+
+func TestOutOfRange(t *testing.T) {
+	p, _ := AppendKey(nil, int64(math.MaxInt32+1))
+	if _, err := DecodeKey[int32](p); err != ErrCorrupt {
+		t.Errorf("int32 out of range: got %v; want ErrCorrupt", err)
+	}
+	p, _ = AppendKey(nil, int64(math.MinInt32-1))
+	if _, err := DecodeKey[int32](p); err != ErrCorrupt {
+		t.Errorf("int32 out of range: got %v; want ErrCorrupt", err)
+	}
+	p, _ = AppendKey(nil, uint64(math.MaxUint32+1))
+	if _, err := DecodeKey[uint32](p); err != ErrCorrupt {
+		t.Errorf("uint32 out of range: got %v; want ErrCorrupt", err)
+	}
+
+	p, _ = AppendKey(nil, int64(math.MinInt32))
+	if k, err := DecodeKey[int32](p); err != nil || k != math.MinInt32 {
+		t.Errorf("MinInt32: got %d, %v", k, err)
+	}
+	p, _ = AppendKey(nil, uint64(math.MaxUint32))
+	if k, err := DecodeKey[uint32](p); err != nil || k != math.MaxUint32 {
+		t.Errorf("MaxUint32: got %d, %v", k, err)
+	}
+}
+
+type mapFile map[string]string
+
+func (m mapFile) WriteTo(w io.Writer) (int64, error) {
+	return Encode(w, len(m), maps.All(m))
+}
+
+func (m mapFile) ReadFrom(r io.Reader) (int64, error) {
+	got, n, err := Decode[string, string](r)
+	if err != nil {
+		return n, err
+	}
+	clear(m)
+	maps.Copy(m, got)
+	return n, nil
+}
+
+type failingWriterTo struct{}
+
+func (failingWriterTo) WriteTo(w io.Writer) (int64, error) {
+	w.Write([]byte("half a snap"))
+	return 0, errors.New("disk on fire")
+}
+
+func TestSaveFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "snap")
+	want := mapFile{"a": "1", "b": "2"}
+	if err := SaveFile(path, want); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed save leaves the previous file alone, and no temp files.
+	if err := SaveFile(path, failingWriterTo{}); err == nil {
+		t.Fatal("SaveFile didn't return the WriteTo error")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("%d files in dir after a failed save; want 1", len(entries))
+	}
+
+	got := mapFile{"stale": "x"}
+	if err := LoadFile(path, got); err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func TestSaveFileMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snap")
+	for _, mode := range []os.FileMode{0o644, 0o640} {
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := SaveFile(path, mapFile{"a": "1"}); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != mode {
+			t.Fatalf("saved over a %v file, got %v", mode, fi.Mode().Perm())
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"math"
+)
+
+// Element ids, written in the header so that decoding into the wrong types
+// fails up front instead of returning garbage.
+const (
+	idString byte = iota + 1
+	idBytes
+	idInt
+	idInt64
+	idInt32
+	idUint64
+	idUint32
+	idUUID // [16]byte
+	idBool
+	idFloat64
+	idGob byte = 0xff // anything else, one gob stream per snapshot
+)
+
+// maxLen bounds the length prefixes we trust, so a corrupted one can't make
+// us allocate the whole address space before the checksum catches it.
+const maxLen = 1 << 30
+
+// elem encodes and decodes values of one type. The gob fallback is stateful,
+// so a fresh elem is needed for every snapshot.
+type elem[T any] struct {
+	id     byte
+	append func(b []byte, v T) ([]byte, error)
+	read   func(r *reader) (T, error)
+}
+
+func elemFor[T any]() elem[T] {
+	var zero T
+	switch any(zero).(type) {
+	case string:
+		return elem[T]{
+			id: idString,
+			append: func(b []byte, v T) ([]byte, error) {
+				s := any(v).(string)
+				b = binary.AppendUvarint(b, uint64(len(s)))
+				return append(b, s...), nil
+			},
+			read: func(r *reader) (T, error) {
+				p, err := r.readLen()
+				return any(string(p)).(T), err
+			},
+		}
+	case []byte:
+		return elem[T]{
+			id: idBytes,
+			append: func(b []byte, v T) ([]byte, error) {
+				s := any(v).([]byte)
+				b = binary.AppendUvarint(b, uint64(len(s)))
+				return append(b, s...), nil
+			},
+			read: func(r *reader) (T, error) {
+				p, err := r.readLen()
+				return any(bytes.Clone(p)).(T), err
+			},
+		}
+	case int:
+		return varint[T](idInt, math.MinInt, math.MaxInt, func(v T) int64 { return int64(any(v).(int)) }, func(x int64) T { return any(int(x)).(T) })
+	case int64:
+		return varint[T](idInt64, math.MinInt64, math.MaxInt64, func(v T) int64 { return any(v).(int64) }, func(x int64) T { return any(x).(T) })
+	case int32:
+		return varint[T](idInt32, math.MinInt32, math.MaxInt32, func(v T) int64 { return int64(any(v).(int32)) }, func(x int64) T { return any(int32(x)).(T) })
+	case uint64:
+		return uvarint[T](idUint64, math.MaxUint64, func(v T) uint64 { return any(v).(uint64) }, func(x uint64) T { return any(x).(T) })
+	case uint32:
+		return uvarint[T](idUint32, math.MaxUint32, func(v T) uint64 { return uint64(any(v).(uint32)) }, func(x uint64) T { return any(uint32(x)).(T) })
+	case [16]byte:
+		return elem[T]{
+			id: idUUID,
+			append: func(b []byte, v T) ([]byte, error) {
+				u := any(v).([16]byte)
+				return append(b, u[:]...), nil
+			},
+			read: func(r *reader) (T, error) {
+				var u [16]byte
+				p, err := r.readN(16)
+				copy(u[:], p)
+				return any(u).(T), err
+			},
+		}
+	case bool:
+		return elem[T]{
+			id: idBool,
+			append: func(b []byte, v T) ([]byte, error) {
+				if any(v).(bool) {
+					return append(b, 1), nil
+				}
+				return append(b, 0), nil
+			},
+			read: func(r *reader) (T, error) {
+				c, err := r.ReadByte()
+				return any(c != 0).(T), err
+			},
+		}
+	case float64:
+		return elem[T]{
+			id: idFloat64,
+			append: func(b []byte, v T) ([]byte, error) {
+				return binary.LittleEndian.AppendUint64(b, math.Float64bits(any(v).(float64))), nil
+			},
+			read: func(r *reader) (T, error) {
+				p, err := r.readN(8)
+				if err != nil {
+					return zero, err
+				}
+				return any(math.Float64frombits(binary.LittleEndian.Uint64(p))).(T), nil
+			},
+		}
+	}
+	return gobElem[T]()
+}
+
+// varint reads values out of [lo, hi] as corrupt, rather than truncating
+// them to T.
+func varint[T any](id byte, lo, hi int64, to func(T) int64, from func(int64) T) elem[T] {
+	return elem[T]{
+		id: id,
+		append: func(b []byte, v T) ([]byte, error) {
+			return binary.AppendVarint(b, to(v)), nil
+		},
+		read: func(r *reader) (T, error) {
+			x, err := binary.ReadVarint(r)
+			if err == nil && (x < lo || x > hi) {
+				err = ErrCorrupt
+			}
+			return from(x), err
+		},
+	}
+}
+
+// uvarint is varint for unsigned T, which go up to hi.
+func uvarint[T any](id byte, hi uint64, to func(T) uint64, from func(uint64) T) elem[T] {
+	return elem[T]{
+		id: id,
+		append: func(b []byte, v T) ([]byte, error) {
+			return binary.AppendUvarint(b, to(v)), nil
+		},
+		read: func(r *reader) (T, error) {
+			x, err := binary.ReadUvarint(r)
+			if err == nil && x > hi {
+				err = ErrCorrupt
+			}
+			return from(x), err
+		},
+	}
+}
+
+// gobElem length prefixes each value's chunk of a single gob stream, so the
+// type description is only written once per snapshot.
+func gobElem[T any]() elem[T] {
+	var (
+		encBuf bytes.Buffer
+		enc    = gob.NewEncoder(&encBuf)
+		decBuf bytes.Buffer
+		dec    = gob.NewDecoder(&decBuf)
+	)
+	return elem[T]{
+		id: idGob,
+		append: func(b []byte, v T) ([]byte, error) {
+			encBuf.Reset()
+			if err := enc.Encode(&v); err != nil {
+				return b, fmt.Errorf("codec: gob encoding %T: %w", v, err)
+			}
+			b = binary.AppendUvarint(b, uint64(encBuf.Len()))
+			return append(b, encBuf.Bytes()...), nil
+		},
+		read: func(r *reader) (T, error) {
+			var v T
+			p, err := r.readLen()
+			if err != nil {
+				return v, err
+			}
+			decBuf.Write(p)
+			if err := dec.Decode(&v); err != nil {
+				return v, fmt.Errorf("codec: gob decoding %T: %w", v, err)
+			}
+			return v, nil
+		},
+	}
+}
@@ -0,0 +1,51 @@
+package codec
+
+import "bytes"
+
+// AppendEntry appends k and v to b, encoded as in a snapshot, for logs and
+// anything else that writes entries one at a time. Every entry stands alone:
+// gob encoded types carry their type description each time.
+func AppendEntry[K comparable, V any](b []byte, k K, v V) ([]byte, error) {
+	b, err := elemFor[K]().append(b, k)
+	if err != nil {
+		return b, err
+	}
+	return elemFor[V]().append(b, v)
+}
+
+// AppendKey is AppendEntry without a value, for deletes.
+func AppendKey[K comparable](b []byte, k K) ([]byte, error) {
+	return elemFor[K]().append(b, k)
+}
+
+// DecodeEntry decodes an entry written by AppendEntry. p must hold exactly
+// one entry.
+func DecodeEntry[K comparable, V any](p []byte) (K, V, error) {
+	var (
+		k K
+		v V
+	)
+	rd := &reader{br: bytes.NewReader(p)}
+	k, err := elemFor[K]().read(rd)
+	if err == nil {
+		v, err = elemFor[V]().read(rd)
+	}
+	return k, v, entryErr(rd, len(p), err)
+}
+
+// DecodeKey decodes a key written by AppendKey. p must hold exactly one key.
+func DecodeKey[K comparable](p []byte) (K, error) {
+	rd := &reader{br: bytes.NewReader(p)}
+	k, err := elemFor[K]().read(rd)
+	return k, entryErr(rd, len(p), err)
+}
+
+func entryErr(rd *reader, n int, err error) error {
+	switch {
+	case err == nil && rd.n != int64(n):
+		return ErrCorrupt
+	case err != nil:
+		return unexpected(err)
+	}
+	return nil
+}
@@ -0,0 +1,379 @@
+// Package hamt is a readheavy-style map backed by a persistent hash array
+// mapped trie. Readers are still lock-free, loading the current root through
+// an atomic.Value, but writers share structure with the previous version and
+// only copy the path from the root to the changed entry, so Set and Delete
+// are O(log n) instead of a full copy of the map.
+package hamt
+
+import (
+	"hash/maphash"
+	"iter"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+)
+
+const (
+	bitsPerLevel = 5
+	width        = 1 << bitsPerLevel
+	levelMask    = width - 1
+	// Once the 64 hash bits run out, the keys left in a node have identical
+	// hashes, and the node becomes a plain collision list.
+	maxShift = 64
+)
+
+// entry is either a leaf (node == nil) or a pointer to a sub trie.
+type entry[K comparable, V any] struct {
+	node  *node[K, V]
+	hash  uint64
+	key   K
+	value V
+}
+
+// node is immutable once published. bitmap has a bit set for every occupied
+// slot, and entries holds them compacted in slot order.
+type node[K comparable, V any] struct {
+	bitmap  uint32
+	entries []entry[K, V]
+}
+
+func slot(hash uint64, shift uint) (uint32, uint32) {
+	return uint32(hash>>shift) & levelMask, 1 << (uint32(hash>>shift) & levelMask)
+}
+
+func (n *node[K, V]) index(bit uint32) int {
+	return bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+func (n *node[K, V]) clone() *node[K, V] {
+	return &node[K, V]{
+		bitmap:  n.bitmap,
+		entries: append(n.entries[:0:0], n.entries...),
+	}
+}
+
+func (n *node[K, V]) get(hash uint64, key K) (V, bool) {
+	for shift := uint(0); ; shift += bitsPerLevel {
+		if shift >= maxShift {
+			for _, e := range n.entries {
+				if e.key == key {
+					return e.value, true
+				}
+			}
+			break
+		}
+		_, bit := slot(hash, shift)
+		if n.bitmap&bit == 0 {
+			break
+		}
+		e := &n.entries[n.index(bit)]
+		if e.node == nil {
+			if e.hash == hash && e.key == key {
+				return e.value, true
+			}
+			break
+		}
+		n = e.node
+	}
+	var zero V
+	return zero, false
+}
+
+// set returns a copy of n with key set, and whether the key is new.
+func (n *node[K, V]) set(leaf entry[K, V], shift uint) (*node[K, V], bool) {
+	if shift >= maxShift {
+		for i, e := range n.entries {
+			if e.key == leaf.key {
+				c := n.clone()
+				c.entries[i] = leaf
+				return c, false
+			}
+		}
+		return &node[K, V]{entries: append(n.entries[:len(n.entries):len(n.entries)], leaf)}, true
+	}
+
+	_, bit := slot(leaf.hash, shift)
+	idx := n.index(bit)
+	if n.bitmap&bit == 0 {
+		c := &node[K, V]{
+			bitmap:  n.bitmap | bit,
+			entries: make([]entry[K, V], len(n.entries)+1),
+		}
+		copy(c.entries, n.entries[:idx])
+		c.entries[idx] = leaf
+		copy(c.entries[idx+1:], n.entries[idx:])
+		return c, true
+	}
+
+	e := n.entries[idx]
+	c := n.clone()
+	switch {
+	case e.node != nil:
+		child, added := e.node.set(leaf, shift+bitsPerLevel)
+		c.entries[idx].node = child
+		return c, added
+	case e.hash == leaf.hash && e.key == leaf.key:
+		c.entries[idx] = leaf
+		return c, false
+	default:
+		c.entries[idx] = entry[K, V]{node: pair(e, leaf, shift+bitsPerLevel)}
+		return c, true
+	}
+}
+
+// pair builds the sub trie holding two leaves that collided at shift-5.
+func pair[K comparable, V any](a, b entry[K, V], shift uint) *node[K, V] {
+	if shift >= maxShift {
+		return &node[K, V]{entries: []entry[K, V]{a, b}}
+	}
+	ia, bita := slot(a.hash, shift)
+	ib, bitb := slot(b.hash, shift)
+	switch {
+	case ia == ib:
+		return &node[K, V]{
+			bitmap:  bita,
+			entries: []entry[K, V]{{node: pair(a, b, shift+bitsPerLevel)}},
+		}
+	case ia < ib:
+		return &node[K, V]{bitmap: bita | bitb, entries: []entry[K, V]{a, b}}
+	default:
+		return &node[K, V]{bitmap: bita | bitb, entries: []entry[K, V]{b, a}}
+	}
+}
+
+// remove returns a copy of n without entry idx, or nil if it ends up empty.
+func (n *node[K, V]) remove(idx int, bit uint32) *node[K, V] {
+	if len(n.entries) == 1 {
+		return nil
+	}
+	c := &node[K, V]{
+		bitmap:  n.bitmap &^ bit,
+		entries: make([]entry[K, V], 0, len(n.entries)-1),
+	}
+	c.entries = append(c.entries, n.entries[:idx]...)
+	c.entries = append(c.entries, n.entries[idx+1:]...)
+	return c
+}
+
+// delete returns a copy of n without key, which is nil if nothing is left,
+// and whether the key was there at all. Sub tries left with a single leaf are
+// pulled up into their parent, so the trie never keeps needless levels.
+func (n *node[K, V]) delete(hash uint64, key K, shift uint) (*node[K, V], bool) {
+	if shift >= maxShift {
+		for i, e := range n.entries {
+			if e.key == key {
+				return n.remove(i, 0), true
+			}
+		}
+		return n, false
+	}
+
+	_, bit := slot(hash, shift)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+	idx := n.index(bit)
+	e := n.entries[idx]
+	if e.node == nil {
+		if e.hash != hash || e.key != key {
+			return n, false
+		}
+		return n.remove(idx, bit), true
+	}
+
+	child, removed := e.node.delete(hash, key, shift+bitsPerLevel)
+	if !removed {
+		return n, false
+	}
+	if child == nil {
+		return n.remove(idx, bit), true
+	}
+	c := n.clone()
+	if len(child.entries) == 1 && child.entries[0].node == nil {
+		c.entries[idx] = child.entries[0]
+	} else {
+		c.entries[idx].node = child
+	}
+	return c, true
+}
+
+func (n *node[K, V]) all(yield func(K, V) bool) bool {
+	for i := range n.entries {
+		e := &n.entries[i]
+		if e.node != nil {
+			if !e.node.all(yield) {
+				return false
+			}
+		} else if !yield(e.key, e.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// root is what gets published, a trie plus its size.
+type root[K comparable, V any] struct {
+	node *node[K, V]
+	len  int
+}
+
+// Map ...
+type Map[K comparable, V any] struct {
+	av   atomic.Value // *root[K, V]
+	mu   sync.Mutex   // used only by writers
+	seed maphash.Seed
+}
+
+// New ...
+func New[K comparable, V any]() *Map[K, V] {
+
+	ret := &Map[K, V]{
+		seed: maphash.MakeSeed(),
+	}
+	ret.av.Store(&root[K, V]{node: &node[K, V]{}})
+
+	return ret
+}
+
+func (m *Map[K, V]) hash(key K) uint64 {
+	return maphash.Comparable(m.seed, key)
+}
+
+func (m *Map[K, V]) load() *root[K, V] {
+	return m.av.Load().(*root[K, V])
+}
+
+// Get ...
+func (m *Map[K, V]) Get(key K) (V, bool) {
+	return m.load().node.get(m.hash(key), key)
+}
+
+// Len ...
+func (m *Map[K, V]) Len() int {
+	return m.load().len
+}
+
+func (r *root[K, V]) set(leaf entry[K, V]) *root[K, V] {
+	n, added := r.node.set(leaf, 0)
+	ret := &root[K, V]{node: n, len: r.len}
+	if added {
+		ret.len++
+	}
+	return ret
+}
+
+// Set ...
+func (m *Map[K, V]) Set(key K, value V) {
+	leaf := entry[K, V]{hash: m.hash(key), key: key, value: value}
+	m.mu.Lock() // synchronize with other potential writers
+	m.av.Store(m.load().set(leaf))
+	m.mu.Unlock()
+}
+
+// Delete ...
+func (m *Map[K, V]) Delete(key K) {
+	hash := m.hash(key)
+	m.mu.Lock() // synchronize with other potential writers
+	r := m.load()
+	if n, removed := r.node.delete(hash, key, 0); removed {
+		if n == nil {
+			n = &node[K, V]{}
+		}
+		m.av.Store(&root[K, V]{node: n, len: r.len - 1})
+	}
+	m.mu.Unlock()
+}
+
+// Tuple ...
+type Tuple[K comparable, V any] = cmap.Tuple[K, V]
+
+// Extend ...
+func (m *Map[K, V]) Extend(e map[K]V) {
+	m.mu.Lock() // synchronize with other potential writers
+	r := m.load()
+	for k, v := range e {
+		r = r.set(entry[K, V]{hash: m.hash(k), key: k, value: v})
+	}
+	m.av.Store(r) // readers see all of e at once
+	m.mu.Unlock()
+}
+
+// ExtendSlice ...
+func (m *Map[K, V]) ExtendSlice(e []Tuple[K, V]) {
+	m.mu.Lock() // synchronize with other potential writers
+	r := m.load()
+	for _, kv := range e {
+		r = r.set(entry[K, V]{hash: m.hash(kv.Key), key: kv.Key, value: kv.Value})
+	}
+	m.av.Store(r) // readers see all of e at once
+	m.mu.Unlock()
+}
+
+// View is an immutable snapshot. Taking one is O(1), as it shares the whole
+// trie with the Map.
+type View[K comparable, V any] struct {
+	r    *root[K, V]
+	seed maphash.Seed
+}
+
+// View ...
+func (m *Map[K, V]) View() *View[K, V] {
+	return &View[K, V]{r: m.load(), seed: m.seed}
+}
+
+// Get ...
+func (v *View[K, V]) Get(key K) (V, bool) {
+	return v.r.node.get(maphash.Comparable(v.seed, key), key)
+}
+
+// Len ...
+func (v *View[K, V]) Len() int {
+	return v.r.len
+}
+
+// All ...
+func (v *View[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		v.r.node.all(yield)
+	}
+}
+
+// Snapshot copies the current version into a plain map.
+func (m *Map[K, V]) Snapshot() map[K]V {
+
+	r := m.load()
+	ret := make(map[K]V, r.len)
+	r.node.all(func(k K, v V) bool {
+		ret[k] = v
+		return true
+	})
+	return ret
+}
+
+// Range calls f for every key and value until f returns false, like
+// sync.Map.Range. Published tries are never mutated, so f is free to call
+// back into the map.
+func (m *Map[K, V]) Range(f func(key K, value V) bool) {
+	m.load().node.all(f)
+}
+
+// All to use with a range-over-func loop.
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	return m.Range
+}
+
+// Keys ...
+func (m *Map[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		m.load().node.all(func(k K, _ V) bool { return yield(k) })
+	}
+}
+
+// Values ...
+func (m *Map[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		m.load().node.all(func(_ K, v V) bool { return yield(v) })
+	}
+}
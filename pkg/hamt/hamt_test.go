@@ -0,0 +1,108 @@
+package hamt
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+	"github.com/antoniomo/gobench/pkg/cmap/cmaptest"
+)
+
+func TestConformance(t *testing.T) {
+	cmaptest.Run(t, func() cmap.Map[string, string] { return New[string, string]() })
+}
+
+// TestRandomOps checks the trie against a builtin map, and that every version
+// handed out as a View stays untouched by later writes.
+func TestRandomOps(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	m := New[int, int]()
+	want := make(map[int]int)
+
+	type version struct {
+		view *View[int, int]
+		want map[int]int
+	}
+	var versions []version
+
+	for i := 0; i < 20000; i++ {
+		k := rng.Intn(2000)
+		if rng.Intn(3) == 0 {
+			m.Delete(k)
+			delete(want, k)
+		} else {
+			m.Set(k, i)
+			want[k] = i
+		}
+		if i%2000 == 0 {
+			cp := make(map[int]int, len(want))
+			for k, v := range want {
+				cp[k] = v
+			}
+			versions = append(versions, version{m.View(), cp})
+		}
+	}
+
+	check := func(name string, got map[int]int, n int, want map[int]int) {
+		t.Helper()
+		if n != len(want) || len(got) != len(want) {
+			t.Fatalf("%s: len = %d, %d entries; want %d", name, n, len(got), len(want))
+		}
+		for k, v := range want {
+			if got[k] != v {
+				t.Fatalf("%s: [%d] = %d; want %d", name, k, got[k], v)
+			}
+		}
+	}
+	check("map", m.Snapshot(), m.Len(), want)
+	for i, v := range versions {
+		got := make(map[int]int)
+		for k, val := range v.view.All() {
+			got[k] = val
+		}
+		check("view "+strconv.Itoa(i), got, v.view.Len(), v.want)
+		for k, val := range v.want {
+			if g, ok := v.view.Get(k); !ok || g != val {
+				t.Fatalf("view %d: Get(%d) = %d, %v; want %d, true", i, k, g, ok, val)
+			}
+		}
+	}
+}
+
+// TestFullHashCollisions drives the nodes directly with a constant hash, which
+// can only be told apart by the collision lists at the bottom of the trie.
+func TestFullHashCollisions(t *testing.T) {
+	const hash = 0xdeadbeef
+	n := &node[string, int]{}
+	for i := 0; i < 10; i++ {
+		var added bool
+		n, added = n.set(entry[string, int]{hash: hash, key: strconv.Itoa(i), value: i}, 0)
+		if !added {
+			t.Fatalf("set(%d) reported an existing key", i)
+		}
+	}
+	n, added := n.set(entry[string, int]{hash: hash, key: "3", value: 33}, 0)
+	if added {
+		t.Fatal("overwrite reported a new key")
+	}
+	if v, ok := n.get(hash, "3"); !ok || v != 33 {
+		t.Fatalf("get(3) = %d, %v; want 33, true", v, ok)
+	}
+
+	for i := 0; i < 10; i++ {
+		var removed bool
+		n, removed = n.delete(hash, strconv.Itoa(i), 0)
+		if !removed {
+			t.Fatalf("delete(%d) didn't find the key", i)
+		}
+		for j := i + 1; j < 10; j++ {
+			if _, ok := n.get(hash, strconv.Itoa(j)); !ok {
+				t.Fatalf("get(%d) lost after delete(%d)", j, i)
+			}
+		}
+	}
+	if n != nil {
+		t.Fatalf("trie not empty after deleting everything: %+v", n)
+	}
+}
@@ -0,0 +1,262 @@
+// Package leftright is a map whose readers never wait, using the Left-Right
+// technique (Ramalhete and Correia, "Left-Right: A Concurrency Control
+// Technique with Wait-Free Population Oblivious Reads").
+//
+// The map is kept twice. Readers use one copy while the writer changes the
+// other, then the two are swapped and the writer, once the readers of the old
+// copy are gone, replays its changes on it. Like readheavy.Map, readers never
+// lock, but a write costs the change twice rather than a copy of the whole
+// map, and the data takes twice the memory.
+//
+// The replay is deferred to the next write, so a writer only ever waits for
+// readers that were already reading before the previous write.
+package leftright
+
+import (
+	"iter"
+	"math/rand/v2"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+)
+
+// slot is a reader counter, padded to its own cache line.
+type slot struct {
+	readers atomic.Int32
+	_       [60]byte
+}
+
+// indicator counts the readers that arrived on one side of the version
+// index, spread over slots so that readers on different cores don't all
+// write the same cache line.
+type indicator []slot
+
+func (ind indicator) arrive() *atomic.Int32 {
+	s := &ind[rand.Uint32()&uint32(len(ind)-1)].readers
+	s.Add(1)
+	return s
+}
+
+func (ind indicator) wait() {
+	for i := range ind {
+		for ind[i].readers.Load() != 0 {
+			runtime.Gosched()
+		}
+	}
+}
+
+type op[K comparable, V any] struct {
+	key   K
+	value V
+	del   bool
+}
+
+func (o op[K, V]) apply(m map[K]V) {
+	if o.del {
+		delete(m, o.key)
+	} else {
+		m[o.key] = o.value
+	}
+}
+
+// Map ...
+type Map[K comparable, V any] struct {
+	maps      [2]map[K]V
+	live      atomic.Int32 // the copy readers use
+	version   atomic.Int32 // the indicator readers arrive on
+	indicator [2]indicator
+
+	mu  sync.Mutex // used only by writers
+	log []op[K, V] // applied to the live copy, not yet to the other one
+}
+
+// New ...
+func New[K comparable, V any]() *Map[K, V] {
+	return NewWithCapacity[K, V](0)
+}
+
+// NewWithCapacity is New with room for capacity entries in both copies.
+func NewWithCapacity[K comparable, V any](capacity int) *Map[K, V] {
+	n := 1
+	for n < 4*runtime.GOMAXPROCS(0) {
+		n <<= 1
+	}
+	return &Map[K, V]{
+		maps:      [2]map[K]V{make(map[K]V, capacity), make(map[K]V, capacity)},
+		indicator: [2]indicator{make(indicator, n), make(indicator, n)},
+	}
+}
+
+// Tuple ...
+type Tuple[K comparable, V any] = cmap.Tuple[K, V]
+
+// read runs f on the live copy. It never waits.
+func (m *Map[K, V]) read(f func(mm map[K]V)) {
+	s := m.indicator[m.version.Load()].arrive()
+	f(m.maps[m.live.Load()])
+	s.Add(-1)
+}
+
+// Get ...
+func (m *Map[K, V]) Get(key K) (V, bool) {
+	// read, by hand, so the closure doesn't cost Get an allocation.
+	s := m.indicator[m.version.Load()].arrive()
+	value, ok := m.maps[m.live.Load()][key]
+	s.Add(-1)
+	return value, ok
+}
+
+// Len ...
+func (m *Map[K, V]) Len() int {
+	s := m.indicator[m.version.Load()].arrive()
+	n := len(m.maps[m.live.Load()])
+	s.Add(-1)
+	return n
+}
+
+// Set ...
+func (m *Map[K, V]) Set(key K, value V) {
+	m.write(op[K, V]{key: key, value: value})
+}
+
+// Delete ...
+func (m *Map[K, V]) Delete(key K) {
+	m.write(op[K, V]{key: key, del: true})
+}
+
+// SetMany is Set for every tuple, published to readers all at once.
+func (m *Map[K, V]) SetMany(e []Tuple[K, V]) {
+	ops := make([]op[K, V], len(e))
+	for i, kv := range e {
+		ops[i] = op[K, V]{key: kv.Key, value: kv.Value}
+	}
+	m.write(ops...)
+}
+
+// DeleteMany is Delete for every key, published to readers all at once.
+func (m *Map[K, V]) DeleteMany(keys []K) {
+	ops := make([]op[K, V], len(keys))
+	for i, k := range keys {
+		ops[i] = op[K, V]{key: k, del: true}
+	}
+	m.write(ops...)
+}
+
+func (m *Map[K, V]) write(ops ...op[K, V]) {
+	// An empty batch must not swap the copies: with nothing in the log, the
+	// next write wouldn't drain the readers of the copy swapped out.
+	if len(ops) == 0 {
+		return
+	}
+	m.mu.Lock()
+	live := m.live.Load()
+	standby := m.maps[1-live]
+
+	// Bring the standby copy up to date with the last write, once nobody
+	// reads it anymore.
+	if len(m.log) > 0 {
+		m.drain()
+		for _, o := range m.log {
+			o.apply(standby)
+		}
+		clear(m.log) // let go of the keys and values
+		m.log = m.log[:0]
+	}
+
+	for _, o := range ops {
+		o.apply(standby)
+	}
+	m.live.Store(1 - live) // new readers see the write from here on
+	m.log = append(m.log, ops...)
+	m.mu.Unlock()
+}
+
+// drain waits until every reader that may still be using the standby copy is
+// done. A reader can't tell which copy it's going to read before it arrives,
+// so the indicators are toggled and both waited on, as in the paper, which
+// keeps a steady flow of new readers from starving the writer.
+func (m *Map[K, V]) drain() {
+	prev := m.version.Load()
+	next := 1 - prev
+	m.indicator[next].wait()
+	m.version.Store(next)
+	m.indicator[prev].wait()
+}
+
+// Snapshot ...
+func (m *Map[K, V]) Snapshot() map[K]V {
+	var ret map[K]V
+	m.read(func(mm map[K]V) {
+		ret = make(map[K]V, len(mm))
+		for k, v := range mm {
+			ret[k] = v
+		}
+	})
+	return ret
+}
+
+// SliceSnapshot ...
+func (m *Map[K, V]) SliceSnapshot() []Tuple[K, V] {
+	var ret []Tuple[K, V]
+	m.read(func(mm map[K]V) {
+		ret = make([]Tuple[K, V], 0, len(mm))
+		for k, v := range mm {
+			ret = append(ret, Tuple[K, V]{Key: k, Value: v})
+		}
+	})
+	return ret
+}
+
+// Range calls f for every key and value until f returns false, like
+// sync.Map.Range. It walks a snapshot: a writer waits for readers of the copy
+// it's about to replay on, so f couldn't write to the map otherwise.
+func (m *Map[K, V]) Range(f func(key K, value V) bool) {
+	for _, kv := range m.SliceSnapshot() {
+		if !f(kv.Key, kv.Value) {
+			return
+		}
+	}
+}
+
+// All to use with a range-over-func loop, with the guarantees of Range.
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	return m.Range
+}
+
+// Keys is like All, but only snapshots and yields the keys.
+func (m *Map[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		var keys []K
+		m.read(func(mm map[K]V) {
+			keys = make([]K, 0, len(mm))
+			for k := range mm {
+				keys = append(keys, k)
+			}
+		})
+		for _, k := range keys {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+// Values is like All, but only snapshots and yields the values.
+func (m *Map[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		var values []V
+		m.read(func(mm map[K]V) {
+			values = make([]V, 0, len(mm))
+			for _, v := range mm {
+				values = append(values, v)
+			}
+		})
+		for _, v := range values {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package leftright
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+	"github.com/antoniomo/gobench/pkg/cmap/cmaptest"
+)
+
+func TestConformance(t *testing.T) {
+	cmaptest.Run(t, func() cmap.Map[string, string] { return New[string, string]() })
+}
+
+// TestCopiesConverge checks the standby copy catches up with every write, so
+// readers see the same map whichever copy they're on.
+func TestCopiesConverge(t *testing.T) {
+	m := New[int, int]()
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+		if i%3 == 0 {
+			m.Delete(i / 2)
+		}
+	}
+	m.Set(-1, -1) // replays the last write on the other copy
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	live, standby := m.maps[m.live.Load()], m.maps[1-m.live.Load()]
+	standby[-1] = -1 // the one write not replayed yet
+	if len(live) != len(standby) {
+		t.Fatalf("copies have %d and %d entries", len(live), len(standby))
+	}
+	for k, v := range live {
+		if sv, ok := standby[k]; !ok || sv != v {
+			t.Fatalf("key %d: live %d, standby %d, %v", k, v, sv, ok)
+		}
+	}
+}
+
+// TestBatchesAreAtomic has readers check that both keys of a SetMany always
+// have the same value. It also has the race detector check that readers and
+// the writer never touch the same copy.
+func TestBatchesAreAtomic(t *testing.T) {
+	m := New[string, int]()
+	m.SetMany([]Tuple[string, int]{{Key: "a", Value: 0}, {Key: "b", Value: 0}})
+
+	var (
+		wg   sync.WaitGroup
+		done atomic.Bool
+	)
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !done.Load() {
+				s := m.Snapshot()
+				if s["a"] != s["b"] {
+					t.Errorf("a = %d, b = %d; a batch was torn", s["a"], s["b"])
+					return
+				}
+				m.Get(strconv.Itoa(s["a"] % 2))
+			}
+		}()
+	}
+	for i := 1; i <= 1000; i++ {
+		m.SetMany([]Tuple[string, int]{{Key: "a", Value: i}, {Key: "b", Value: i}})
+	}
+	done.Store(true)
+	wg.Wait()
+
+	if v, _ := m.Get("a"); v != 1000 {
+		t.Fatalf("Get(a) = %d; want 1000", v)
+	}
+	m.DeleteMany([]string{"a", "b"})
+	if m.Len() != 0 {
+		t.Fatalf("Len() = %d after DeleteMany; want 0", m.Len())
+	}
+}
+
+// TestEmptyBatch checks an empty SetMany or DeleteMany doesn't swap the
+// copies. If they did, a second one would swap back without waiting for the
+// readers of the copy the next write changes, which the race detector
+// catches.
+func TestEmptyBatch(t *testing.T) {
+	m := New[string, int]()
+	m.Set("a", 1)
+	m.SetMany(nil)
+
+	ready := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.read(func(mm map[string]int) {
+			close(ready)
+			for i := 0; i < 1000; i++ {
+				if mm["a"] != 1 {
+					t.Errorf("a = %d; want 1", mm["a"])
+					return
+				}
+				runtime.Gosched() // let the writer in while we read
+			}
+		})
+	}()
+	<-ready
+	m.DeleteMany([]string{})
+	m.Set("b", 2)
+	wg.Wait()
+
+	if v, ok := m.Get("b"); !ok || v != 2 {
+		t.Fatalf("Get(b) = %d, %v; want 2, true", v, ok)
+	}
+}
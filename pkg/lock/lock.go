@@ -1,20 +1,36 @@
 package lock
 
-import "sync"
+import (
+	"io"
+	"iter"
+	"sync"
+	"time"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+	"github.com/antoniomo/gobench/pkg/codec"
+)
 
 // Map ...
-type Map struct {
+type Map[K comparable, V any] struct {
 	mu sync.Mutex
-	m  map[string]string
+	m  map[K]V
+	// version is bumped on every write, guarded by mu.
+	version uint64
 }
 
 // New ...
-func New() *Map {
-	return &Map{m: make(map[string]string)}
+func New[K comparable, V any]() *Map[K, V] {
+	return &Map[K, V]{m: make(map[K]V)}
+}
+
+// NewWithCapacity is New with room for capacity entries before the map has to
+// grow.
+func NewWithCapacity[K comparable, V any](capacity int) *Map[K, V] {
+	return &Map[K, V]{m: make(map[K]V, capacity)}
 }
 
 // Get ...
-func (m *Map) Get(key string) (string, bool) {
+func (m *Map[K, V]) Get(key K) (V, bool) {
 	m.mu.Lock()
 	value, ok := m.m[key]
 	m.mu.Unlock()
@@ -22,34 +38,96 @@ func (m *Map) Get(key string) (string, bool) {
 }
 
 // Set ...
-func (m *Map) Set(key, value string) {
+func (m *Map[K, V]) Set(key K, value V) {
 	m.mu.Lock()
 	m.m[key] = value
+	m.version++
 	m.mu.Unlock()
 }
 
 // Delete ...
-func (m *Map) Delete(key string) {
+func (m *Map[K, V]) Delete(key K) {
 	m.mu.Lock()
-	delete(m.m, key)
+	if _, ok := m.m[key]; ok {
+		delete(m.m, key)
+		m.version++
+	}
 	m.mu.Unlock()
 }
 
-// Tuple ...
-type Tuple struct {
-	Key   string
-	Value string
+// GetMany is Get for every key, under a single lock acquisition. The results
+// are in the same order as keys.
+func (m *Map[K, V]) GetMany(keys []K) []Result[V] {
+	ret := make([]Result[V], len(keys))
+	m.mu.Lock()
+	for i, k := range keys {
+		ret[i].Value, ret[i].Ok = m.m[k]
+	}
+	m.mu.Unlock()
+	return ret
+}
+
+// SetMany is Set for every tuple, in order, under a single lock acquisition.
+func (m *Map[K, V]) SetMany(e []Tuple[K, V]) {
+	m.mu.Lock()
+	for _, kv := range e {
+		m.m[kv.Key] = kv.Value
+	}
+	if len(e) > 0 {
+		m.version++
+	}
+	m.mu.Unlock()
+}
+
+// DeleteMany is Delete for every key, under a single lock acquisition.
+func (m *Map[K, V]) DeleteMany(keys []K) {
+	m.mu.Lock()
+	n := len(m.m)
+	for _, k := range keys {
+		delete(m.m, k)
+	}
+	if len(m.m) != n {
+		m.version++
+	}
+	m.mu.Unlock()
+}
+
+// Len ...
+func (m *Map[K, V]) Len() int {
+	m.mu.Lock()
+	n := len(m.m)
+	m.mu.Unlock()
+	return n
 }
 
+// Clear deletes every entry, keeping the memory the map has grown to.
+func (m *Map[K, V]) Clear() {
+	m.mu.Lock()
+	if len(m.m) > 0 {
+		clear(m.m)
+		m.version++
+	}
+	m.mu.Unlock()
+}
+
+// Tuple ...
+type Tuple[K comparable, V any] = cmap.Tuple[K, V]
+
+// Result ...
+type Result[V any] = cmap.Result[V]
+
 // Iter to use with a range loop
-func (m *Map) Iter() <-chan Tuple {
+//
+// Deprecated: use All, it needs neither a goroutine nor a channel buffer the
+// size of the map.
+func (m *Map[K, V]) Iter() <-chan Tuple[K, V] {
 
 	snap := m.Snapshot()
 	// Fully buffered, trade memory for speed baby!
-	ret := make(chan Tuple, len(snap))
+	ret := make(chan Tuple[K, V], len(snap))
 	go func() {
 		for k, v := range snap {
-			ret <- Tuple{k, v}
+			ret <- Tuple[K, V]{Key: k, Value: v}
 		}
 		close(ret)
 	}()
@@ -57,11 +135,13 @@ func (m *Map) Iter() <-chan Tuple {
 }
 
 // IterSlice to use with a range loop (with slice snapshot)
-func (m *Map) IterSlice() <-chan Tuple {
+//
+// Deprecated: use All.
+func (m *Map[K, V]) IterSlice() <-chan Tuple[K, V] {
 
 	snap := m.SliceSnapshot()
 	// Fully buffered, trade memory for speed baby!
-	ret := make(chan Tuple, len(snap))
+	ret := make(chan Tuple[K, V], len(snap))
 	go func() {
 		for _, v := range snap {
 			ret <- v
@@ -72,9 +152,9 @@ func (m *Map) IterSlice() <-chan Tuple {
 }
 
 // Snapshot ...
-func (m *Map) Snapshot() map[string]string {
+func (m *Map[K, V]) Snapshot() map[K]V {
 
-	ret := make(map[string]string)
+	ret := make(map[K]V)
 	m.mu.Lock()
 	for k, v := range m.m {
 		ret[k] = v
@@ -83,15 +163,204 @@ func (m *Map) Snapshot() map[string]string {
 	return ret
 }
 
+// VersionedSnapshot is Snapshot tagged with its version, read atomically
+// together.
+func (m *Map[K, V]) VersionedSnapshot() cmap.Versioned[K, V] {
+
+	m.mu.Lock()
+	ret := cmap.Versioned[K, V]{Version: m.version, Map: make(map[K]V, len(m.m))}
+	for k, v := range m.m {
+		ret.Map[k] = v
+	}
+	m.mu.Unlock()
+	return ret
+}
+
 // SliceSnapshot ...
-func (m *Map) SliceSnapshot() []Tuple {
+func (m *Map[K, V]) SliceSnapshot() []Tuple[K, V] {
 	i := 0
 	m.mu.Lock()
-	ret := make([]Tuple, len(m.m))
+	ret := make([]Tuple[K, V], len(m.m))
 	for k, v := range m.m {
-		ret[i] = Tuple{k, v}
+		ret[i] = Tuple[K, V]{Key: k, Value: v}
 		i++
 	}
 	m.mu.Unlock()
 	return ret
 }
+
+// Range calls f for every key and value until f returns false, like
+// sync.Map.Range. It walks a snapshot, so f is free to call back into the map.
+func (m *Map[K, V]) Range(f func(key K, value V) bool) {
+	for _, kv := range m.SliceSnapshot() {
+		if !f(kv.Key, kv.Value) {
+			return
+		}
+	}
+}
+
+// All to use with a range-over-func loop. The snapshot is taken when the loop
+// starts, and breaking out early leaves nothing behind.
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	return m.Range
+}
+
+// Keys is like All, but only snapshots and yields the keys.
+func (m *Map[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		m.mu.Lock()
+		keys := make([]K, 0, len(m.m))
+		for k := range m.m {
+			keys = append(keys, k)
+		}
+		m.mu.Unlock()
+		for _, k := range keys {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+// Values is like All, but only snapshots and yields the values.
+func (m *Map[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		m.mu.Lock()
+		values := make([]V, 0, len(m.m))
+		for _, v := range m.m {
+			values = append(values, v)
+		}
+		m.mu.Unlock()
+		for _, v := range values {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// LoadOrStore returns the existing value for key if there is one. Otherwise
+// it stores value and returns it. loaded is true if the value was there.
+func (m *Map[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	m.mu.Lock()
+	actual, loaded = m.m[key]
+	if !loaded {
+		m.m[key] = value
+		m.version++
+		actual = value
+	}
+	m.mu.Unlock()
+	return actual, loaded
+}
+
+// LoadAndDelete deletes key, returning its previous value if there was one.
+func (m *Map[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	m.mu.Lock()
+	value, loaded = m.m[key]
+	if loaded {
+		delete(m.m, key)
+		m.version++
+	}
+	m.mu.Unlock()
+	return value, loaded
+}
+
+// Swap stores value for key, returning the previous value if there was one.
+func (m *Map[K, V]) Swap(key K, value V) (previous V, loaded bool) {
+	m.mu.Lock()
+	previous, loaded = m.m[key]
+	m.m[key] = value
+	m.version++
+	m.mu.Unlock()
+	return previous, loaded
+}
+
+// CompareAndSwap stores new for key only if its current value equals old. As
+// with sync.Map, it panics if V isn't comparable at run time.
+func (m *Map[K, V]) CompareAndSwap(key K, old, new V) (swapped bool) {
+	m.mu.Lock()
+	cur, ok := m.m[key]
+	if ok && any(cur) == any(old) {
+		m.m[key] = new
+		m.version++
+		swapped = true
+	}
+	m.mu.Unlock()
+	return swapped
+}
+
+// CompareAndDelete deletes key only if its current value equals old. As with
+// sync.Map, it panics if V isn't comparable at run time.
+func (m *Map[K, V]) CompareAndDelete(key K, old V) (deleted bool) {
+	m.mu.Lock()
+	cur, ok := m.m[key]
+	if ok && any(cur) == any(old) {
+		delete(m.m, key)
+		m.version++
+		deleted = true
+	}
+	m.mu.Unlock()
+	return deleted
+}
+
+// Update calls f with the current value for key, if any, and stores what f
+// returns, or deletes key if f returns false. It all happens under one lock,
+// so no other writer can get in between the read and the write. f must not
+// call back into the map.
+func (m *Map[K, V]) Update(key K, f func(old V, ok bool) (V, bool)) (V, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock() // f may panic
+	old, ok := m.m[key]
+	value, keep := f(old, ok)
+	if keep {
+		m.m[key] = value
+		m.version++
+	} else if ok {
+		delete(m.m, key)
+		m.version++
+	}
+	return value, keep
+}
+
+// WriteTo writes a checksummed binary snapshot of the map to w, in the
+// pkg/codec format. The map is copied first, so writers aren't held up by a
+// slow w.
+func (m *Map[K, V]) WriteTo(w io.Writer) (int64, error) {
+	snap := m.SliceSnapshot()
+	return codec.Encode(w, len(snap), func(yield func(K, V) bool) {
+		for _, t := range snap {
+			if !yield(t.Key, t.Value) {
+				return
+			}
+		}
+	})
+}
+
+// ReadFrom replaces the contents of the map with a snapshot written by
+// WriteTo. The snapshot is decoded and verified in full first: on error the
+// map is left as it was.
+func (m *Map[K, V]) ReadFrom(r io.Reader) (int64, error) {
+	loaded, n, err := codec.Decode[K, V](r)
+	if err != nil {
+		return n, err
+	}
+	m.mu.Lock()
+	m.m = loaded
+	m.version++
+	m.mu.Unlock()
+	return n, nil
+}
+
+// WaitLock takes the lock and lets it go, returning how long it had to wait
+// for it, or 0 if it was free. It's for metrics.Wrap to time lock waits on a
+// sample of operations, so that the others don't pay for it.
+func (m *Map[K, V]) WaitLock() time.Duration {
+	if m.mu.TryLock() {
+		m.mu.Unlock()
+		return 0
+	}
+	start := time.Now()
+	m.mu.Lock()
+	m.mu.Unlock()
+	return time.Since(start)
+}
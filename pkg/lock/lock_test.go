@@ -0,0 +1,65 @@
+package lock
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+	"github.com/antoniomo/gobench/pkg/cmap/cmaptest"
+)
+
+func TestConformance(t *testing.T) {
+	cmaptest.Run(t, func() cmap.Map[string, string] { return New[string, string]() })
+}
+
+func TestAtomicConformance(t *testing.T) {
+	cmaptest.RunAtomic(t, func() cmap.AtomicMap[string, int] { return New[string, int]() })
+}
+
+func TestVersionedConformance(t *testing.T) {
+	cmaptest.RunVersioned(t, func() cmap.VersionedMap[string, string] { return New[string, string]() })
+}
+
+func TestBulk(t *testing.T) {
+	m := New[string, int]()
+	m.SetMany([]Tuple[string, int]{{Key: "a", Value: 1}, {Key: "b", Value: 2}, {Key: "a", Value: 3}})
+	got := m.GetMany([]string{"a", "b", "c"})
+	want := []Result[int]{{Value: 3, Ok: true}, {Value: 2, Ok: true}, {}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("GetMany = %v; want %v", got, want)
+	}
+
+	m.DeleteMany([]string{"a", "c"})
+	got = m.GetMany([]string{"a", "b"})
+	want = []Result[int]{{}, {Value: 2, Ok: true}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("GetMany after DeleteMany = %v; want %v", got, want)
+	}
+	if v := m.VersionedSnapshot().Version; v != 2 {
+		t.Fatalf("Version = %d; want 2, one per batch", v)
+	}
+	m.DeleteMany([]string{"a", "c"})
+	m.SetMany(nil)
+	if v := m.VersionedSnapshot().Version; v != 2 {
+		t.Fatalf("Version = %d after batches that changed nothing; want 2", v)
+	}
+}
+
+func TestLenClear(t *testing.T) {
+	m := NewWithCapacity[string, int](10)
+	m.SetMany([]Tuple[string, int]{{Key: "a", Value: 1}, {Key: "b", Value: 2}})
+	if n := m.Len(); n != 2 {
+		t.Fatalf("Len() = %d; want 2", n)
+	}
+	m.Clear()
+	if n := m.Len(); n != 0 {
+		t.Fatalf("Len() = %d after Clear; want 0", n)
+	}
+	if _, ok := m.Get("a"); ok {
+		t.Fatal("Get found a cleared key")
+	}
+	m.Set("c", 3)
+	if n := m.Len(); n != 1 {
+		t.Fatalf("Len() = %d after Clear and Set; want 1", n)
+	}
+}
@@ -0,0 +1,483 @@
+// Package lockfree is a non-blocking hash map: a split-ordered list (Shalev
+// and Shavit, "Split-Ordered Lists: Lock-Free Extensible Hash Tables").
+//
+// Every entry lives in a single lock-free linked list (Harris and Michael),
+// sorted by the bit reversed hash of its key. A bucket is a shortcut into
+// that list, a sentinel node placed where its keys start. Doubling the
+// number of buckets splits every bucket in two without moving a single
+// entry, so the table grows while writers carry on, and new buckets are
+// initialized lazily by whoever needs them first.
+//
+// Go can't steal pointer bits for the deletion mark, so every next pointer
+// goes through an immutable link, replaced as a whole by CAS. An entry is
+// logically deleted by swapping its value pointer to nil, and physically
+// unlinked once its link is marked.
+package lockfree
+
+import (
+	"hash/maphash"
+	"iter"
+	"math/bits"
+	"sync/atomic"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+)
+
+// loadFactor is the mean number of entries per bucket that makes the table
+// double its buckets.
+const loadFactor = 4
+
+type node[K comparable, V any] struct {
+	sokey uint64 // split order key, even for sentinels, odd for entries
+	key   K
+	value atomic.Pointer[V] // nil for sentinels and deleted entries
+	next  atomic.Pointer[link[K, V]]
+}
+
+// link is a next pointer and the deletion mark of the node holding it.
+type link[K comparable, V any] struct {
+	n      *node[K, V]
+	marked bool
+}
+
+func (n *node[K, V]) sentinel() bool {
+	return n.sokey&1 == 0
+}
+
+// segment i holds buckets [2^(i-1), 2^i), segment 0 just bucket 0, so the
+// bucket array grows without ever being copied.
+type segment[K comparable, V any] []atomic.Pointer[node[K, V]]
+
+// Map ...
+type Map[K comparable, V any] struct {
+	segments [65]atomic.Pointer[segment[K, V]]
+	size     atomic.Uint64 // number of buckets, a power of two
+	count    atomic.Int64
+	seed     maphash.Seed
+}
+
+// New ...
+func New[K comparable, V any]() *Map[K, V] {
+	return NewWithCapacity[K, V](0)
+}
+
+// NewWithCapacity is New starting with enough buckets for capacity entries.
+func NewWithCapacity[K comparable, V any](capacity int) *Map[K, V] {
+	ret := &Map[K, V]{seed: maphash.MakeSeed()}
+	size := uint64(1)
+	for size*loadFactor < uint64(max(capacity, 0)) {
+		size <<= 1
+	}
+	ret.size.Store(size)
+	head := &node[K, V]{}
+	head.next.Store(&link[K, V]{})
+	ret.slot(0).Store(head)
+	return ret
+}
+
+// Tuple ...
+type Tuple[K comparable, V any] = cmap.Tuple[K, V]
+
+// Result ...
+type Result[V any] = cmap.Result[V]
+
+func (m *Map[K, V]) hash(key K) uint64 {
+	return maphash.Comparable(m.seed, key)
+}
+
+// entryKey is the split order key of an entry with hash h.
+func entryKey(h uint64) uint64 {
+	return bits.Reverse64(h) | 1
+}
+
+// slot returns where bucket b's sentinel goes, allocating its segment if
+// needed.
+func (m *Map[K, V]) slot(b uint64) *atomic.Pointer[node[K, V]] {
+	i := bits.Len64(b)
+	seg := m.segments[i].Load()
+	if seg == nil {
+		n := 1
+		if i > 0 {
+			n = 1 << (i - 1)
+		}
+		s := make(segment[K, V], n)
+		if !m.segments[i].CompareAndSwap(nil, &s) {
+			seg = m.segments[i].Load()
+		} else {
+			seg = &s
+		}
+	}
+	if i > 0 {
+		b -= 1 << (i - 1)
+	}
+	return &(*seg)[b]
+}
+
+// bucket returns the sentinel of the bucket for hash h, initializing it if
+// needed.
+func (m *Map[K, V]) bucket(h uint64) *node[K, V] {
+	b := h & (m.size.Load() - 1)
+	if s := m.slot(b).Load(); s != nil {
+		return s
+	}
+	return m.initBucket(b)
+}
+
+// initBucket inserts the sentinel of bucket b after its parent's, the bucket
+// it splits from.
+func (m *Map[K, V]) initBucket(b uint64) *node[K, V] {
+	parent := b &^ (1 << (bits.Len64(b) - 1))
+	ps := m.slot(parent).Load()
+	if ps == nil {
+		ps = m.initBucket(parent)
+	}
+
+	s := &node[K, V]{sokey: bits.Reverse64(b)}
+	for {
+		prev, pl, curr, found := m.find(ps, s.sokey, s.key)
+		if found {
+			s = curr // someone else got there first
+			break
+		}
+		s.next.Store(&link[K, V]{n: curr})
+		if prev.next.CompareAndSwap(pl, &link[K, V]{n: s}) {
+			break
+		}
+	}
+	m.slot(b).CompareAndSwap(nil, s)
+	return s
+}
+
+// find looks for the node with sokey and, for entries, key, starting at the
+// sentinel head. If it's not there, curr is the node it would go before.
+// Either way pl is prev's link to curr, to CAS a new node in between. Marked
+// nodes found on the way are unlinked.
+func (m *Map[K, V]) find(head *node[K, V], sokey uint64, key K) (prev *node[K, V], pl *link[K, V], curr *node[K, V], found bool) {
+retry:
+	prev = head
+	pl = prev.next.Load()
+	curr = pl.n
+	for curr != nil {
+		cl := curr.next.Load()
+		if cl.marked {
+			nl := &link[K, V]{n: cl.n}
+			if !prev.next.CompareAndSwap(pl, nl) {
+				goto retry // prev changed under us
+			}
+			pl, curr = nl, cl.n
+			continue
+		}
+		if curr.sokey > sokey {
+			break
+		}
+		if curr.sokey == sokey && (curr.sentinel() || curr.key == key) {
+			return prev, pl, curr, true
+		}
+		prev, pl, curr = curr, cl, cl.n
+	}
+	return prev, pl, curr, false
+}
+
+// lookup is find for readers: it skips over deleted nodes rather than
+// unlinking them. It only writes to initialise key's bucket, if nothing has
+// used it yet.
+func (m *Map[K, V]) lookup(key K) *node[K, V] {
+	h := m.hash(key)
+	sokey := entryKey(h)
+	for curr := m.bucket(h).next.Load().n; curr != nil; curr = curr.next.Load().n {
+		if curr.sokey > sokey {
+			return nil
+		}
+		if curr.sokey == sokey && curr.key == key {
+			return curr
+		}
+	}
+	return nil
+}
+
+// unlink marks a logically deleted node, then tries to unlink it.
+func (m *Map[K, V]) unlink(n *node[K, V], h uint64) {
+	for {
+		l := n.next.Load()
+		if l.marked {
+			break
+		}
+		if n.next.CompareAndSwap(l, &link[K, V]{n: l.n, marked: true}) {
+			break
+		}
+	}
+	m.find(m.bucket(h), n.sokey, n.key) // unlinks it on the way
+}
+
+// insert adds a node for key with value, unless there's a live one already,
+// which it returns instead.
+func (m *Map[K, V]) insert(key K, value *V) (existing *node[K, V], old *V) {
+	h := m.hash(key)
+	n := &node[K, V]{sokey: entryKey(h), key: key}
+	n.value.Store(value)
+	for {
+		prev, pl, curr, found := m.find(m.bucket(h), n.sokey, key)
+		if found {
+			if v := curr.value.Load(); v != nil {
+				return curr, v
+			}
+			m.unlink(curr, h) // deleted, but still in the way
+			continue
+		}
+		n.next.Store(&link[K, V]{n: curr})
+		if prev.next.CompareAndSwap(pl, &link[K, V]{n: n}) {
+			m.grow(m.count.Add(1))
+			return nil, nil
+		}
+	}
+}
+
+func (m *Map[K, V]) grow(count int64) {
+	size := m.size.Load()
+	if uint64(count) > size*loadFactor && size < 1<<62 {
+		m.size.CompareAndSwap(size, size*2) // if it fails, someone else grew it
+	}
+}
+
+// delete logically deletes n if its value is still v, and unlinks it.
+func (m *Map[K, V]) delete(n *node[K, V], v *V) bool {
+	if !n.value.CompareAndSwap(v, nil) {
+		return false
+	}
+	m.count.Add(-1)
+	m.unlink(n, m.hash(n.key))
+	return true
+}
+
+// Get ...
+func (m *Map[K, V]) Get(key K) (V, bool) {
+	if n := m.lookup(key); n != nil {
+		if v := n.value.Load(); v != nil {
+			return *v, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// Set ...
+func (m *Map[K, V]) Set(key K, value V) {
+	m.Swap(key, value)
+}
+
+// Delete ...
+func (m *Map[K, V]) Delete(key K) {
+	m.LoadAndDelete(key)
+}
+
+// LoadOrStore ...
+func (m *Map[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	if n := m.lookup(key); n != nil {
+		if v := n.value.Load(); v != nil {
+			return *v, true
+		}
+	}
+	if _, old := m.insert(key, &value); old != nil {
+		return *old, true
+	}
+	return value, false
+}
+
+// LoadAndDelete ...
+func (m *Map[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	for {
+		n := m.lookup(key)
+		if n == nil {
+			return value, false
+		}
+		v := n.value.Load()
+		if v == nil {
+			return value, false
+		}
+		if m.delete(n, v) {
+			return *v, true
+		}
+	}
+}
+
+// Swap ...
+func (m *Map[K, V]) Swap(key K, value V) (previous V, loaded bool) {
+	for {
+		n, old := m.insert(key, &value)
+		if n == nil {
+			return previous, false
+		}
+		if n.value.CompareAndSwap(old, &value) {
+			return *old, true
+		}
+		// Changed or deleted in between, start over.
+	}
+}
+
+// CompareAndSwap ...
+func (m *Map[K, V]) CompareAndSwap(key K, old, new V) (swapped bool) {
+	for {
+		n := m.lookup(key)
+		if n == nil {
+			return false
+		}
+		v := n.value.Load()
+		if v == nil || any(*v) != any(old) {
+			return false
+		}
+		if n.value.CompareAndSwap(v, &new) {
+			return true
+		}
+	}
+}
+
+// CompareAndDelete ...
+func (m *Map[K, V]) CompareAndDelete(key K, old V) (deleted bool) {
+	for {
+		n := m.lookup(key)
+		if n == nil {
+			return false
+		}
+		v := n.value.Load()
+		if v == nil || any(*v) != any(old) {
+			return false
+		}
+		if m.delete(n, v) {
+			return true
+		}
+	}
+}
+
+// Update calls f with the current value for key, if any, and stores what f
+// returns, or deletes key if f returns false. Nothing is locked: if another
+// writer gets in between, f is called again with the new value, so f must be
+// free of side effects.
+func (m *Map[K, V]) Update(key K, f func(old V, ok bool) (V, bool)) (V, bool) {
+	for {
+		var (
+			old V
+			v   *V
+		)
+		n := m.lookup(key)
+		if n != nil {
+			v = n.value.Load()
+		}
+		if v != nil {
+			old = *v
+		}
+		value, keep := f(old, v != nil)
+		switch {
+		case v == nil && !keep:
+			return value, false
+		case v == nil:
+			if existing, _ := m.insert(key, &value); existing == nil {
+				return value, true
+			}
+		case !keep:
+			if m.delete(n, v) {
+				return value, false
+			}
+		default:
+			if n.value.CompareAndSwap(v, &value) {
+				return value, true
+			}
+		}
+	}
+}
+
+// GetMany is Get for every key. Unlike lock.Map's, the results aren't a
+// snapshot: writers can get in between keys.
+func (m *Map[K, V]) GetMany(keys []K) []Result[V] {
+	ret := make([]Result[V], len(keys))
+	for i, k := range keys {
+		ret[i].Value, ret[i].Ok = m.Get(k)
+	}
+	return ret
+}
+
+// SetMany is Set for every tuple, in order. Readers can see some of them
+// before the rest.
+func (m *Map[K, V]) SetMany(e []Tuple[K, V]) {
+	for _, kv := range e {
+		m.Set(kv.Key, kv.Value)
+	}
+}
+
+// DeleteMany is Delete for every key. Readers can see some of them before
+// the rest.
+func (m *Map[K, V]) DeleteMany(keys []K) {
+	for _, k := range keys {
+		m.Delete(k)
+	}
+}
+
+// Len is approximately the number of entries. Under concurrent writes it's
+// only a moment's estimate: entries are counted after they're inserted, so a
+// Delete can uncount one before its Set has counted it. Len clamps that at 0.
+func (m *Map[K, V]) Len() int {
+	return max(int(m.count.Load()), 0)
+}
+
+// Clear deletes every entry, one by one. Entries set while it runs may
+// survive it.
+func (m *Map[K, V]) Clear() {
+	for n := m.slot(0).Load(); n != nil; n = n.next.Load().n {
+		if v := n.value.Load(); v != nil {
+			m.delete(n, v)
+		}
+	}
+}
+
+// Range calls f for every key and value until f returns false, like
+// sync.Map.Range: it sees every entry present for the whole walk once, and
+// may or may not see the ones written during it. f is free to call back into
+// the map.
+func (m *Map[K, V]) Range(f func(key K, value V) bool) {
+	for n := m.slot(0).Load(); n != nil; n = n.next.Load().n {
+		if v := n.value.Load(); v != nil {
+			if !f(n.key, *v) {
+				return
+			}
+		}
+	}
+}
+
+// All to use with a range-over-func loop, with the guarantees of Range.
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	return m.Range
+}
+
+// Keys is like All, but only yields the keys.
+func (m *Map[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		m.Range(func(k K, _ V) bool { return yield(k) })
+	}
+}
+
+// Values is like All, but only yields the values.
+func (m *Map[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		m.Range(func(_ K, v V) bool { return yield(v) })
+	}
+}
+
+// Snapshot copies the map with Range, so it isn't a point in time view
+// under concurrent writes.
+func (m *Map[K, V]) Snapshot() map[K]V {
+	ret := make(map[K]V, max(m.Len(), 0))
+	m.Range(func(k K, v V) bool {
+		ret[k] = v
+		return true
+	})
+	return ret
+}
+
+// SliceSnapshot is Snapshot as a slice.
+func (m *Map[K, V]) SliceSnapshot() []Tuple[K, V] {
+	ret := make([]Tuple[K, V], 0, max(m.Len(), 0))
+	m.Range(func(k K, v V) bool {
+		ret = append(ret, Tuple[K, V]{Key: k, Value: v})
+		return true
+	})
+	return ret
+}
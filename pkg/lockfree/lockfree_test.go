@@ -0,0 +1,108 @@
+package lockfree
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+	"github.com/antoniomo/gobench/pkg/cmap/cmaptest"
+)
+
+func TestConformance(t *testing.T) {
+	cmaptest.Run(t, func() cmap.Map[string, string] { return New[string, string]() })
+}
+
+func TestAtomicConformance(t *testing.T) {
+	cmaptest.RunAtomic(t, func() cmap.AtomicMap[string, int] { return New[string, int]() })
+}
+
+// TestGrowUnderWrites has writers insert and delete disjoint keys while the
+// table doubles its buckets from one to thousands.
+func TestGrowUnderWrites(t *testing.T) {
+	const (
+		workers = 8
+		perKeys = 5000
+	)
+	m := New[int, int]()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w * perKeys; i < (w+1)*perKeys; i++ {
+				m.Set(i, i)
+				if i%2 == 0 {
+					m.Delete(i)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if n := m.Len(); n != workers*perKeys/2 {
+		t.Fatalf("Len() = %d; want %d", n, workers*perKeys/2)
+	}
+	for i := 0; i < workers*perKeys; i++ {
+		v, ok := m.Get(i)
+		if want := i%2 == 1; ok != want || (ok && v != i) {
+			t.Fatalf("Get(%d) = %d, %v; want %d, %v", i, v, ok, i, want)
+		}
+	}
+	if size := m.size.Load(); size*loadFactor < uint64(m.Len()) {
+		t.Fatalf("%d buckets for %d entries; the table didn't grow", size, m.Len())
+	}
+}
+
+// TestSameKeyChurn has every writer set and delete the same few keys, which
+// is where a deleted node and its replacement meet in the list.
+func TestSameKeyChurn(t *testing.T) {
+	const workers = 8
+	m := New[string, int]()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10000; i++ {
+				k := strconv.Itoa(i % 4)
+				m.Set(k, i)
+				m.Delete(k)
+				m.LoadOrStore(k, i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// However the writers interleaved, a key is in the list at most once, and
+	// Len agrees with what's there.
+	seen := map[string]int{}
+	for k := range m.Keys() {
+		seen[k]++
+	}
+	for k, n := range seen {
+		if n != 1 {
+			t.Fatalf("key %q found %d times in the list", k, n)
+		}
+	}
+	if len(seen) != m.Len() {
+		t.Fatalf("%d keys in the list, Len() = %d", len(seen), m.Len())
+	}
+}
+
+func TestCapacityAndClear(t *testing.T) {
+	m := NewWithCapacity[int, int](1000)
+	if size := m.size.Load(); size*loadFactor < 1000 {
+		t.Fatalf("%d buckets for a capacity of 1000", size)
+	}
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+	}
+	m.Clear()
+	if n := m.Len(); n != 0 {
+		t.Fatalf("Len() = %d after Clear; want 0", n)
+	}
+	for range m.All() {
+		t.Fatal("All yielded an entry after Clear")
+	}
+}
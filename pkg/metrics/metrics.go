@@ -0,0 +1,224 @@
+// Package metrics wraps a map to count what's done to it and measure what it
+// costs, so contention can be seen in production rather than guessed from
+// benchmarks.
+package metrics
+
+import (
+	"expvar"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// Store is all Wrap needs. Every map in pkg/ is one, slicemap's with string
+// keys and values.
+type Store[K comparable, V any] interface {
+	Get(key K) (V, bool)
+	Set(key K, value V)
+	Delete(key K)
+}
+
+// lockWaiter is implemented by lock.Map and rwlock.Map.
+type lockWaiter interface {
+	WaitLock() time.Duration
+}
+
+// rlockWaiter is implemented by rwlock.Map.
+type rlockWaiter interface {
+	WaitRLock() time.Duration
+}
+
+// copyObserver is implemented by readheavy.Map.
+type copyObserver interface {
+	ObserveCopies(f func(entries int))
+}
+
+// Stats ...
+type Stats struct {
+	Gets    uint64
+	Hits    uint64
+	Misses  uint64
+	Sets    uint64
+	Deletes uint64
+
+	// Sampled is the number of operations timed, one in every sampleEvery,
+	// and OpTime the total time they took, lock wait included.
+	Sampled uint64
+	OpTime  time.Duration
+
+	// LockWaits is the number of sampled operations that found the lock
+	// taken, and LockWaitTime how long they waited in total. Only for maps
+	// that can be asked, lock.Map and rwlock.Map.
+	LockWaits    uint64
+	LockWaitTime time.Duration
+	MaxLockWait  time.Duration
+
+	// CopiedEntries is the number of entries copy-on-write maps copied, and
+	// CopiedBytes their size, keys and values shallowly. Only for maps that
+	// report it, readheavy.Map.
+	CopiedEntries uint64
+	CopiedBytes   uint64
+}
+
+// MeanOpTime is the mean time of the sampled operations.
+func (s Stats) MeanOpTime() time.Duration {
+	if s.Sampled == 0 {
+		return 0
+	}
+	return s.OpTime / time.Duration(s.Sampled)
+}
+
+// Map is a Store that records Stats. Its counters are shared by every
+// goroutine using the map, which adds some contention of its own: it's meant
+// to be opt-in.
+type Map[K comparable, V any] struct {
+	m           Store[K, V]
+	sampleEvery uint64
+
+	gets, hits, misses, sets, deletes atomic.Uint64
+
+	sampled atomic.Uint64
+	opTime  atomic.Int64
+
+	lockWaits    atomic.Uint64
+	lockWaitTime atomic.Int64
+	maxLockWait  atomic.Int64
+
+	copiedEntries atomic.Uint64
+}
+
+// Wrap returns m with metrics, timing one in every sampleEvery operations, or
+// none if sampleEvery is 0. If m has a lock, the timed operations first wait
+// for it on their own, to see how long that takes: the lock paths of m stay
+// as they are for everyone else. If m can report copies, Wrap hooks into it,
+// replacing any previous Wrap of the same m.
+func Wrap[K comparable, V any](m Store[K, V], sampleEvery int) *Map[K, V] {
+	ret := &Map[K, V]{m: m, sampleEvery: uint64(max(sampleEvery, 0))}
+	if o, ok := m.(copyObserver); ok {
+		o.ObserveCopies(ret.observeCopies)
+	}
+	return ret
+}
+
+// Unwrap returns the wrapped map, unhooked from Stats.
+func (m *Map[K, V]) Unwrap() Store[K, V] {
+	if o, ok := m.m.(copyObserver); ok {
+		o.ObserveCopies(nil)
+	}
+	return m.m
+}
+
+// sample reports whether the n-th operation of its kind should be timed.
+func (m *Map[K, V]) sample(n uint64) bool {
+	return m.sampleEvery != 0 && n%m.sampleEvery == 0
+}
+
+// waitLock waits for the lock of the map, if it has one, and records the wait.
+// read is for operations that only take a read lock.
+func (m *Map[K, V]) waitLock(read bool) {
+	var wait time.Duration
+	if w, ok := m.m.(rlockWaiter); ok && read {
+		wait = w.WaitRLock()
+	} else if w, ok := m.m.(lockWaiter); ok {
+		wait = w.WaitLock()
+	}
+	if wait > 0 {
+		m.observeLockWait(wait)
+	}
+}
+
+func (m *Map[K, V]) timed(start time.Time) {
+	m.sampled.Add(1)
+	m.opTime.Add(int64(time.Since(start)))
+}
+
+// Get ...
+func (m *Map[K, V]) Get(key K) (V, bool) {
+	var (
+		value V
+		ok    bool
+	)
+	if m.sample(m.gets.Add(1)) {
+		m.waitLock(true)
+		start := time.Now()
+		value, ok = m.m.Get(key)
+		m.timed(start)
+	} else {
+		value, ok = m.m.Get(key)
+	}
+	if ok {
+		m.hits.Add(1)
+	} else {
+		m.misses.Add(1)
+	}
+	return value, ok
+}
+
+// Set ...
+func (m *Map[K, V]) Set(key K, value V) {
+	if m.sample(m.sets.Add(1)) {
+		m.waitLock(false)
+		start := time.Now()
+		m.m.Set(key, value)
+		m.timed(start)
+		return
+	}
+	m.m.Set(key, value)
+}
+
+// Delete ...
+func (m *Map[K, V]) Delete(key K) {
+	if m.sample(m.deletes.Add(1)) {
+		m.waitLock(false)
+		start := time.Now()
+		m.m.Delete(key)
+		m.timed(start)
+		return
+	}
+	m.m.Delete(key)
+}
+
+func (m *Map[K, V]) observeLockWait(wait time.Duration) {
+	m.lockWaits.Add(1)
+	m.lockWaitTime.Add(int64(wait))
+	for {
+		cur := m.maxLockWait.Load()
+		if int64(wait) <= cur || m.maxLockWait.CompareAndSwap(cur, int64(wait)) {
+			return
+		}
+	}
+}
+
+func (m *Map[K, V]) observeCopies(entries int) {
+	m.copiedEntries.Add(uint64(entries))
+}
+
+// Stats returns the counters so far. They're read one by one while the map
+// is in use, so they can be slightly out of step with each other.
+func (m *Map[K, V]) Stats() Stats {
+	var (
+		k K
+		v V
+	)
+	copied := m.copiedEntries.Load()
+	return Stats{
+		Gets:          m.gets.Load(),
+		Hits:          m.hits.Load(),
+		Misses:        m.misses.Load(),
+		Sets:          m.sets.Load(),
+		Deletes:       m.deletes.Load(),
+		Sampled:       m.sampled.Load(),
+		OpTime:        time.Duration(m.opTime.Load()),
+		LockWaits:     m.lockWaits.Load(),
+		LockWaitTime:  time.Duration(m.lockWaitTime.Load()),
+		MaxLockWait:   time.Duration(m.maxLockWait.Load()),
+		CopiedEntries: copied,
+		CopiedBytes:   copied * uint64(unsafe.Sizeof(k)+unsafe.Sizeof(v)),
+	}
+}
+
+// Publish exports Stats as the expvar name, so they show up in
+// /debug/vars. Like expvar.Publish, it panics if name is already taken.
+func (m *Map[K, V]) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() any { return m.Stats() }))
+}
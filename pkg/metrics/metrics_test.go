@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/antoniomo/gobench/pkg/lock"
+	"github.com/antoniomo/gobench/pkg/readheavy"
+	"github.com/antoniomo/gobench/pkg/rwlock"
+	"github.com/antoniomo/gobench/pkg/slicemap"
+)
+
+func TestCounts(t *testing.T) {
+	for name, s := range map[string]Store[string, string]{
+		"lock":      lock.New[string, string](),
+		"rwlock":    rwlock.New[string, string](),
+		"readheavy": readheavy.New[string, string](),
+		"linear":    &slicemap.LinearSlicemap{},
+		"binary":    &slicemap.BinarySlicemap{},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := Wrap(s, 2)
+			m.Set("a", "1")
+			m.Set("b", "2")
+			m.Get("a")
+			m.Get("b")
+			m.Get("c")
+			m.Delete("a")
+			m.Get("a")
+
+			got := m.Stats()
+			want := Stats{Gets: 4, Hits: 2, Misses: 2, Sets: 2, Deletes: 1, Sampled: 3}
+			got.OpTime, got.CopiedEntries, got.CopiedBytes = 0, 0, 0
+			if got != want {
+				t.Fatalf("got %+v; want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestLockWait(t *testing.T) {
+	lm := lock.New[string, int]()
+	m := Wrap(lm, 1)
+
+	held := make(chan struct{})
+	release := make(chan struct{})
+	go lm.Update("a", func(int, bool) (int, bool) {
+		close(held)
+		<-release
+		return 1, true
+	})
+	<-held
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+	m.Get("a") // waits for Update
+
+	s := m.Stats()
+	if s.LockWaits != 1 || s.LockWaitTime < 5*time.Millisecond || s.MaxLockWait != s.LockWaitTime {
+		t.Fatalf("got %+v; want a single wait of about 10ms", s)
+	}
+
+	m.Get("a") // uncontended, not a wait
+	if s := m.Stats(); s.LockWaits != 1 {
+		t.Fatalf("LockWaits = %d after an uncontended Get; want 1", s.LockWaits)
+	}
+
+	m.Unwrap()
+	held, release = make(chan struct{}), make(chan struct{})
+	go lm.Update("a", func(int, bool) (int, bool) {
+		close(held)
+		<-release
+		return 1, true
+	})
+	<-held
+	close(release)
+	lm.Get("a")
+	if s := m.Stats(); s.LockWaits != 1 {
+		t.Fatalf("LockWaits = %d after Unwrap; want 1", s.LockWaits)
+	}
+}
+
+func TestCopies(t *testing.T) {
+	rh := readheavy.New[string, int64]()
+	m := Wrap(rh, 0)
+	m.Set("a", 1) // copies nothing
+	m.Set("b", 2) // copies a
+	m.Set("c", 3) // copies a and b
+	m.Delete("x") // not there, no copy
+	rh.Update(func(tx *readheavy.Tx[string, int64]) {
+		tx.Set("d", 4) // copies a, b and c
+	})
+
+	s := m.Stats()
+	if s.CopiedEntries != 6 || s.CopiedBytes != 6*(16+8) {
+		t.Fatalf("CopiedEntries, CopiedBytes = %d, %d; want 6, %d", s.CopiedEntries, s.CopiedBytes, 6*(16+8))
+	}
+}
+
+func TestPublish(t *testing.T) {
+	m := Wrap[string, string](lock.New[string, string](), 0)
+	m.Publish("metrics_test_map")
+	m.Set("a", "1")
+	m.Get("a")
+
+	var s Stats
+	if err := json.Unmarshal([]byte(expvar.Get("metrics_test_map").String()), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Sets != 1 || s.Hits != 1 {
+		t.Fatalf("published %+v; want a set and a hit", s)
+	}
+}
@@ -0,0 +1,327 @@
+// Package offheap is a string map the garbage collector doesn't have to
+// look into.
+//
+// A map[string]V holds a pointer per key, and every GC cycle follows all of
+// them: with tens of millions of entries, marking alone takes seconds (see
+// cmd/gcbench). Here keys and values are copied into large byte
+// arenas, and the index is an open addressing table of hashes and arena
+// offsets. Neither holds a pointer, so the GC sees a few big noscan objects
+// whatever the number of entries.
+//
+// The price is a copy on the way in and on the way out, and that deleted and
+// overwritten entries stay in the arena until it's compacted, which happens
+// on its own once they take more room than the live ones.
+package offheap
+
+import (
+	"encoding/binary"
+	"hash/maphash"
+	"iter"
+	"sync"
+)
+
+const (
+	// chunkSize is the size of an arena chunk. Entries never span chunks; a
+	// bigger one gets a chunk of its own.
+	chunkSize = 4 << 20
+
+	// minGarbage is how many bytes of dead entries it takes before they're
+	// worth compacting away.
+	minGarbage = chunkSize
+
+	minTable = 8
+)
+
+// slot is an index entry. ref is 0 for an empty slot, or the chunk of the
+// entry, plus one, and its offset in the chunk.
+type slot struct {
+	hash uint64
+	ref  uint64
+}
+
+func makeRef(chunk, off int) uint64 {
+	return uint64(chunk+1)<<32 | uint64(off)
+}
+
+func (s slot) chunk() int { return int(s.ref>>32) - 1 }
+func (s slot) off() int   { return int(uint32(s.ref)) }
+
+// arena is append only: bytes, once written, never change, so a copy of its
+// chunk headers still reads the entries it had after later writes.
+type arena [][]byte
+
+// entry returns the key and value at s. An entry is the uvarint lengths of
+// its key and value, followed by both.
+func (a arena) entry(s slot) (key, value []byte) {
+	b := a[s.chunk()][s.off():]
+	kl, n := binary.Uvarint(b)
+	b = b[n:]
+	vl, n := binary.Uvarint(b)
+	b = b[n:]
+	return b[:kl], b[kl : kl+vl]
+}
+
+func entrySize(keyLen, valueLen int) int {
+	return uvarintLen(keyLen) + uvarintLen(valueLen) + keyLen + valueLen
+}
+
+func uvarintLen(x int) int {
+	n := 1
+	for ; x >= 0x80; x >>= 7 {
+		n++
+	}
+	return n
+}
+
+// add appends an entry and returns where it went. It takes strings from Set
+// and bytes from compact, without converting either.
+func add[S ~string | ~[]byte](a *arena, key, value S) uint64 {
+	size := entrySize(len(key), len(value))
+	last := len(*a) - 1
+	if last < 0 || len((*a)[last])+size > cap((*a)[last]) {
+		*a = append(*a, make([]byte, 0, max(chunkSize, size)))
+		last++
+	}
+	c := (*a)[last]
+	off := len(c)
+	c = binary.AppendUvarint(c, uint64(len(key)))
+	c = binary.AppendUvarint(c, uint64(len(value)))
+	c = append(c, key...)
+	c = append(c, value...)
+	(*a)[last] = c
+	return makeRef(last, off)
+}
+
+// Map is a map[string]string kept off the GC's books. Its zero value isn't
+// usable, use New.
+type Map struct {
+	mu    sync.Mutex
+	seed  maphash.Seed
+	table []slot // a power of two, at most 3/4 full
+	count int
+	arena arena
+	size  int // bytes in the arena
+	dead  int // bytes of deleted and overwritten entries
+}
+
+// New ...
+func New() *Map {
+	return NewWithCapacity(0)
+}
+
+// NewWithCapacity is New with an index big enough for capacity entries.
+func NewWithCapacity(capacity int) *Map {
+	n := minTable
+	for n*3/4 < capacity {
+		n <<= 1
+	}
+	return &Map{seed: maphash.MakeSeed(), table: make([]slot, n)}
+}
+
+// find returns the index of key's slot, or of the empty slot where it would
+// go.
+func (m *Map) find(key string, h uint64) (int, bool) {
+	mask := len(m.table) - 1
+	for i := int(h) & mask; ; i = (i + 1) & mask {
+		s := m.table[i]
+		if s.ref == 0 {
+			return i, false
+		}
+		if s.hash == h {
+			if k, _ := m.arena.entry(s); string(k) == key {
+				return i, true
+			}
+		}
+	}
+}
+
+// Get ...
+func (m *Map) Get(key string) (string, bool) {
+	h := maphash.String(m.seed, key)
+	m.mu.Lock()
+	i, ok := m.find(key, h)
+	var value string
+	if ok {
+		_, v := m.arena.entry(m.table[i])
+		value = string(v)
+	}
+	m.mu.Unlock()
+	return value, ok
+}
+
+// Set ...
+func (m *Map) Set(key, value string) {
+	h := maphash.String(m.seed, key)
+	m.mu.Lock()
+	i, ok := m.find(key, h)
+	if ok {
+		k, v := m.arena.entry(m.table[i])
+		m.dead += entrySize(len(k), len(v))
+	} else if (m.count+1)*4 > len(m.table)*3 {
+		m.resize(len(m.table) * 2)
+		i, _ = m.find(key, h)
+	}
+	if !ok {
+		m.count++
+	}
+	m.table[i] = slot{hash: h, ref: add(&m.arena, key, value)}
+	m.size += entrySize(len(key), len(value))
+	m.maybeCompact()
+	m.mu.Unlock()
+}
+
+// Delete ...
+func (m *Map) Delete(key string) {
+	h := maphash.String(m.seed, key)
+	m.mu.Lock()
+	if i, ok := m.find(key, h); ok {
+		k, v := m.arena.entry(m.table[i])
+		m.dead += entrySize(len(k), len(v))
+		m.remove(i)
+		m.count--
+		m.maybeCompact()
+	}
+	m.mu.Unlock()
+}
+
+// remove empties slot i, shifting back the slots after it that belong
+// before it, so that lookups need no tombstones.
+func (m *Map) remove(i int) {
+	mask := len(m.table) - 1
+	for j := (i + 1) & mask; m.table[j].ref != 0; j = (j + 1) & mask {
+		home := int(m.table[j].hash) & mask
+		// j can move to i if i is on its way from home to j.
+		if (j-home)&mask >= (j-i)&mask {
+			m.table[i] = m.table[j]
+			i = j
+		}
+	}
+	m.table[i] = slot{}
+}
+
+func (m *Map) resize(n int) {
+	old := m.table
+	m.table = make([]slot, n)
+	mask := n - 1
+	for _, s := range old {
+		if s.ref == 0 {
+			continue
+		}
+		i := int(s.hash) & mask
+		for m.table[i].ref != 0 {
+			i = (i + 1) & mask
+		}
+		m.table[i] = s
+	}
+}
+
+func (m *Map) maybeCompact() {
+	if m.dead >= minGarbage && m.dead > m.size-m.dead {
+		m.compact()
+	}
+}
+
+// Compact copies the live entries to a new arena, to give back the memory of
+// the deleted and overwritten ones.
+func (m *Map) Compact() {
+	m.mu.Lock()
+	m.compact()
+	m.mu.Unlock()
+}
+
+func (m *Map) compact() {
+	// A new arena rather than moving entries down in place, as iterations
+	// may still be reading the old one.
+	var a arena
+	for i, s := range m.table {
+		if s.ref != 0 {
+			k, v := m.arena.entry(s)
+			m.table[i].ref = add(&a, k, v)
+		}
+	}
+	m.arena = a
+	m.size -= m.dead
+	m.dead = 0
+}
+
+// Len ...
+func (m *Map) Len() int {
+	m.mu.Lock()
+	n := m.count
+	m.mu.Unlock()
+	return n
+}
+
+// Clear deletes every entry and drops the arena, keeping the index size.
+func (m *Map) Clear() {
+	m.mu.Lock()
+	clear(m.table)
+	m.count = 0
+	m.arena = nil
+	m.size, m.dead = 0, 0
+	m.mu.Unlock()
+}
+
+// Size returns how many bytes the arena takes, and how many of them are
+// dead entries waiting for a compaction.
+func (m *Map) Size() (size, dead int) {
+	m.mu.Lock()
+	size, dead = m.size, m.dead
+	m.mu.Unlock()
+	return size, dead
+}
+
+// All to use with a range-over-func loop. It walks a copy of the index, and
+// the arena as it was then, so the loop is free to write to the map. The
+// copy has no pointers either: it's 16 bytes per entry of index.
+func (m *Map) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		m.mu.Lock()
+		table := make([]slot, 0, m.count)
+		for _, s := range m.table {
+			if s.ref != 0 {
+				table = append(table, s)
+			}
+		}
+		a := append(arena(nil), m.arena...)
+		m.mu.Unlock()
+
+		for _, s := range table {
+			k, v := a.entry(s)
+			if !yield(string(k), string(v)) {
+				return
+			}
+		}
+	}
+}
+
+// Keys is like All, but only yields the keys.
+func (m *Map) Keys() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for k := range m.All() {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+// Values is like All, but only yields the values.
+func (m *Map) Values() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, v := range m.All() {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// Snapshot ...
+func (m *Map) Snapshot() map[string]string {
+	ret := make(map[string]string, m.Len())
+	for k, v := range m.All() {
+		ret[k] = v
+	}
+	return ret
+}
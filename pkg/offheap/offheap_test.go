@@ -0,0 +1,185 @@
+package offheap
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand/v2"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+	"github.com/antoniomo/gobench/pkg/cmap/cmaptest"
+)
+
+func TestConformance(t *testing.T) {
+	cmaptest.Run(t, func() cmap.Map[string, string] { return New() })
+}
+
+// TestAgainstMap runs random writes on a Map and a map[string]string, so
+// that deletes shift back every kind of probe sequence, and compares them.
+func TestAgainstMap(t *testing.T) {
+	m := New()
+	want := map[string]string{}
+	for i := 0; i < 100000; i++ {
+		k := strconv.Itoa(rand.IntN(2000))
+		if rand.IntN(3) == 0 {
+			m.Delete(k)
+			delete(want, k)
+		} else {
+			v := strings.Repeat("v", rand.IntN(300)) // some lengths need two byte uvarints
+			m.Set(k, v)
+			want[k] = v
+		}
+	}
+
+	if m.Len() != len(want) {
+		t.Fatalf("Len() = %d; want %d", m.Len(), len(want))
+	}
+	for i := 0; i < 2000; i++ {
+		k := strconv.Itoa(i)
+		v, ok := m.Get(k)
+		if wv, wok := want[k]; ok != wok || v != wv {
+			t.Fatalf("Get(%q) = %d bytes, %v; want %d bytes, %v", k, len(v), ok, len(wv), wok)
+		}
+	}
+	if size, dead := m.Size(); dead > size-dead && dead >= minGarbage {
+		t.Fatalf("%d of %d arena bytes are dead; it should have been compacted", dead, size)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	m := New()
+	for i := 0; i < 1000; i++ {
+		m.Set(strconv.Itoa(i), "old")
+	}
+	for i := 0; i < 1000; i += 2 {
+		m.Set(strconv.Itoa(i), "new")
+		m.Delete(strconv.Itoa(i + 1))
+	}
+	before := m.All()
+
+	size, dead := m.Size()
+	if dead == 0 {
+		t.Fatal("no dead bytes after overwrites and deletes")
+	}
+	m.Compact()
+	if s, d := m.Size(); d != 0 || s != size-dead {
+		t.Fatalf("Size() = %d, %d after Compact; want %d, 0", s, d, size-dead)
+	}
+	for i := 0; i < 1000; i++ {
+		v, ok := m.Get(strconv.Itoa(i))
+		if i%2 == 0 && (!ok || v != "new") || i%2 == 1 && ok {
+			t.Fatalf("Get(%d) = %q, %v after Compact", i, v, ok)
+		}
+	}
+
+	// An iteration started before still reads the old arena.
+	n := 0
+	for k, v := range before {
+		if v != "new" {
+			t.Fatalf("%s = %q in an iteration started before Compact", k, v)
+		}
+		n++
+	}
+	if n != 500 {
+		t.Fatalf("iteration yielded %d entries; want 500", n)
+	}
+}
+
+func TestBigEntry(t *testing.T) {
+	m := New()
+	big := strings.Repeat("x", chunkSize+1)
+	m.Set("small", "v")
+	m.Set("big", big)
+	m.Set("after", "v")
+	if v, ok := m.Get("big"); !ok || v != big {
+		t.Fatalf("Get(big) = %d bytes, %v", len(v), ok)
+	}
+	if v, ok := m.Get("after"); !ok || v != "v" {
+		t.Fatalf("Get(after) = %q, %v", v, ok)
+	}
+}
+
+func TestClear(t *testing.T) {
+	m := NewWithCapacity(100)
+	for i := 0; i < 100; i++ {
+		m.Set(strconv.Itoa(i), "v")
+	}
+	m.Clear()
+	if m.Len() != 0 {
+		t.Fatalf("Len() = %d after Clear; want 0", m.Len())
+	}
+	if size, _ := m.Size(); size != 0 {
+		t.Fatalf("arena has %d bytes after Clear", size)
+	}
+	for range m.All() {
+		t.Fatal("All yielded an entry after Clear")
+	}
+}
+
+// gcElements is how many uuids BenchmarkGC stores. cmd/gcbench uses 10
+// million by default, which takes a while to set up: a million is enough to
+// see the difference.
+const gcElements = 1000000
+
+func uuidv4() [16]byte {
+	var u [16]byte
+	binary.LittleEndian.PutUint64(u[:8], rand.Uint64())
+	binary.LittleEndian.PutUint64(u[8:], rand.Uint64())
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return u
+}
+
+func uuidString(u [16]byte) string {
+	var b [36]byte
+	hex.Encode(b[:8], u[:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return string(b[:])
+}
+
+// BenchmarkGC times a full runtime.GC() with gcElements uuids in each kind
+// of map, as cmd/gcbench does, so ns/op is the time a collection takes.
+func BenchmarkGC(b *testing.B) {
+	b.Run("map[string]int", func(b *testing.B) {
+		m := map[string]int{}
+		for i := 0; i < gcElements; i++ {
+			m[uuidString(uuidv4())] = i
+		}
+		timeGC(b)
+		runtime.KeepAlive(m)
+	})
+	b.Run("map[[16]byte]int", func(b *testing.B) {
+		m := map[[16]byte]int{}
+		for i := 0; i < gcElements; i++ {
+			m[uuidv4()] = i
+		}
+		timeGC(b)
+		runtime.KeepAlive(m)
+	})
+	b.Run("offheap", func(b *testing.B) {
+		m := NewWithCapacity(gcElements)
+		for i := 0; i < gcElements; i++ {
+			m.Set(uuidString(uuidv4()), strconv.Itoa(i))
+		}
+		timeGC(b)
+		runtime.KeepAlive(m)
+	})
+}
+
+func timeGC(b *testing.B) {
+	runtime.GC() // the garbage left from filling the map
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+	}
+}
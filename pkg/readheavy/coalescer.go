@@ -0,0 +1,139 @@
+package readheavy
+
+import (
+	"sync"
+	"time"
+)
+
+type op[K comparable, V any] struct {
+	key    K
+	value  V
+	delete bool
+}
+
+// Coalescer buffers writes to a Map and publishes them in batches through
+// Update, so a burst of writes costs one copy of the map instead of one each.
+// Buffered writes aren't visible to readers of the Map until they're flushed.
+type Coalescer[K comparable, V any] struct {
+	m         *Map[K, V]
+	batchSize int
+
+	mu      sync.Mutex // guards ops and closed
+	ops     []op[K, V]
+	closed  bool
+	flushMu sync.Mutex // keeps batches in order
+
+	kick chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewCoalescer starts a background goroutine that flushes the buffered writes
+// every interval, and as soon as batchSize of them pile up. A zero interval
+// or batchSize disables that trigger. Call Close to stop it.
+func NewCoalescer[K comparable, V any](m *Map[K, V], interval time.Duration, batchSize int) *Coalescer[K, V] {
+	c := &Coalescer[K, V]{
+		m:         m,
+		batchSize: batchSize,
+		kick:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	c.wg.Add(1)
+	go c.loop(interval)
+	return c
+}
+
+func (c *Coalescer[K, V]) loop(interval time.Duration) {
+	defer c.wg.Done()
+	var tick <-chan time.Time
+	if interval > 0 {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		select {
+		case <-tick:
+		case <-c.kick:
+		case <-c.done:
+			return
+		}
+		c.Flush()
+	}
+}
+
+func (c *Coalescer[K, V]) add(o op[K, V]) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		c.flushMu.Lock() // let Close finish flushing the earlier writes
+		c.apply([]op[K, V]{o})
+		c.flushMu.Unlock()
+		return
+	}
+	c.ops = append(c.ops, o)
+	full := c.batchSize > 0 && len(c.ops) >= c.batchSize
+	c.mu.Unlock()
+	if full {
+		select {
+		case c.kick <- struct{}{}:
+		default: // a flush is already pending
+		}
+	}
+}
+
+// Set buffers a Set. After Close it's applied right away.
+func (c *Coalescer[K, V]) Set(key K, value V) {
+	c.add(op[K, V]{key: key, value: value})
+}
+
+// Delete buffers a Delete. After Close it's applied right away.
+func (c *Coalescer[K, V]) Delete(key K) {
+	c.add(op[K, V]{key: key, delete: true})
+}
+
+// Flush publishes the buffered writes now.
+func (c *Coalescer[K, V]) Flush() {
+	c.flushMu.Lock()
+	c.mu.Lock()
+	ops := c.ops
+	c.ops = nil
+	c.mu.Unlock()
+	c.apply(ops)
+	c.flushMu.Unlock()
+}
+
+func (c *Coalescer[K, V]) apply(ops []op[K, V]) {
+	if len(ops) == 0 {
+		return
+	}
+	c.m.Update(func(tx *Tx[K, V]) {
+		for _, o := range ops {
+			if o.delete {
+				tx.Delete(o.key)
+			} else {
+				tx.Set(o.key, o.value)
+			}
+		}
+	})
+}
+
+// Close flushes what's left and stops the background goroutine.
+func (c *Coalescer[K, V]) Close() {
+	c.flushMu.Lock()
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		c.flushMu.Unlock()
+		return
+	}
+	c.closed = true
+	ops := c.ops
+	c.ops = nil
+	c.mu.Unlock()
+	c.apply(ops)
+	c.flushMu.Unlock()
+
+	close(c.done)
+	c.wg.Wait()
+}
@@ -1,49 +1,147 @@
 package readheavy
 
 import (
+	"io"
+	"iter"
 	"sync"
 	"sync/atomic"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+	"github.com/antoniomo/gobench/pkg/codec"
 )
 
 // Adapted from https://golang.org/pkg/sync/atomic/#example_Value_readMostly
 
-type innerMap map[string]string
+type innerMap[K comparable, V any] map[K]V
+
+// state is what gets published: a map that's never written to again, and the
+// version it was published as.
+type state[K comparable, V any] struct {
+	m       innerMap[K, V]
+	version uint64
+}
 
 // Map ...
-type Map struct {
+type Map[K comparable, V any] struct {
 	av atomic.Value
 	mu sync.Mutex // used only by writers
-	m  innerMap
+	// capacity every new version is made with, at least.
+	capacity int
+
+	watchers watchers[K, V]    // guarded by mu
+	onCopy   func(entries int) // guarded by mu
 }
 
 // New ...
-func New() *Map {
+func New[K comparable, V any]() *Map[K, V] {
 
-	ret := &Map{
-		m: make(innerMap),
-	}
-	ret.av.Store(ret.m)
+	ret := &Map[K, V]{}
+	ret.av.Store(&state[K, V]{m: make(innerMap[K, V])})
 
 	return ret
 }
 
+// NewWithCapacity is New with every version of the map made with room for
+// capacity entries, so that copying it on every write doesn't have to grow it
+// along the way.
+func NewWithCapacity[K comparable, V any](capacity int) *Map[K, V] {
+
+	ret := &Map[K, V]{capacity: capacity}
+	ret.av.Store(&state[K, V]{m: make(innerMap[K, V], capacity)})
+
+	return ret
+}
+
+// Len ...
+func (m *Map[K, V]) Len() int {
+	return len(m.load().m)
+}
+
+// Clear publishes an empty map. Readers may still be using the old one, so
+// there's no memory to reuse, but there's nothing to copy either.
+func (m *Map[K, V]) Clear() {
+	m.mu.Lock()
+	m1 := m.load().m
+	if len(m1) == 0 {
+		m.mu.Unlock()
+		return
+	}
+	m.publish(m.newVersion(0))
+	if m.watching() {
+		evs := make([]Event[K, V], 0, len(m1))
+		for k, old := range m1 {
+			evs = append(evs, Event[K, V]{Kind: EventDelete, Key: k, Old: old, HadOld: true})
+		}
+		m.notify(evs...)
+	}
+	m.mu.Unlock()
+}
+
+// newVersion makes the map for a version that will hold n entries, or
+// m.capacity if that's more, so that filling it doesn't grow it.
+func (m *Map[K, V]) newVersion(n int) innerMap[K, V] {
+	return make(innerMap[K, V], max(n, m.capacity))
+}
+
+func (m *Map[K, V]) load() *state[K, V] {
+	return m.av.Load().(*state[K, V])
+}
+
+// publish stores m2 as the next version. It must be called with mu held.
+func (m *Map[K, V]) publish(m2 innerMap[K, V]) {
+	m.av.Store(&state[K, V]{m: m2, version: m.load().version + 1})
+}
+
+// Version is bumped by every write that publishes a new map.
+func (m *Map[K, V]) Version() uint64 {
+	return m.load().version
+}
+
+// VersionedSnapshot is a Clone of Snapshot, tagged with its version.
+func (m *Map[K, V]) VersionedSnapshot() cmap.Versioned[K, V] {
+	v := m.Snapshot()
+	return cmap.Versioned[K, V]{Version: v.Version(), Map: v.Clone()}
+}
+
+// ObserveCopies makes every write call f with the number of entries it
+// copied, which is what a write costs here. f is called with the writers'
+// lock held, so it must be cheap and must not write to the map. A nil f stops
+// observing.
+func (m *Map[K, V]) ObserveCopies(f func(entries int)) {
+	m.mu.Lock()
+	m.onCopy = f
+	m.mu.Unlock()
+}
+
+// copied must be called with mu held.
+func (m *Map[K, V]) copied(entries int) {
+	if m.onCopy != nil {
+		m.onCopy(entries)
+	}
+}
+
 // Get ...
-func (m *Map) Get(key string) (string, bool) {
-	m1 := m.av.Load().(innerMap)
+func (m *Map[K, V]) Get(key K) (V, bool) {
+	m1 := m.load().m
 	value, ok := m1[key]
 	return value, ok
 }
 
 // Set ...
-func (m *Map) Set(key, value string) {
-	m.mu.Lock()                  // synchronize with other potential writers
-	m1 := m.av.Load().(innerMap) // load current value of the data structure
-	m2 := make(innerMap)         // create a new value
+func (m *Map[K, V]) Set(key K, value V) {
+	m.mu.Lock()                     // synchronize with other potential writers
+	m1 := m.load().m                // load current value of the data structure
+	m2 := m.newVersion(len(m1) + 1) // create a new value
 	for k, v := range m1 {
 		m2[k] = v // copy all data from the current object to the new one
 	}
+	m.copied(len(m1))
+	old, had := m2[key]
 	m2[key] = value // do the update that we need
-	m.av.Store(m2)  // atomically replace the current object with the new one
+	m.publish(m2)   // atomically replace the current object with the new one
+	if m.watching() {
+		m.notify(Event[K, V]{Kind: EventSet, Key: key, Old: old, HadOld: had, New: value})
+	}
 	m.mu.Unlock()
 	// At this point all new readers start working with the new version.
 	// The old version will be garbage collected once the existing readers
@@ -51,15 +149,24 @@ func (m *Map) Set(key, value string) {
 }
 
 // Delete ...
-func (m *Map) Delete(key string) {
-	m.mu.Lock()                  // synchronize with other potential writers
-	m1 := m.av.Load().(innerMap) // load current value of the data structure
-	m2 := make(innerMap)         // create a new value
-	delete(m1, key)              // do the update that we need
+func (m *Map[K, V]) Delete(key K) {
+	m.mu.Lock()      // synchronize with other potential writers
+	m1 := m.load().m // load current value of the data structure
+	old, ok := m1[key]
+	if !ok {
+		m.mu.Unlock() // nothing to delete, keep the published map
+		return
+	}
+	m2 := m.newVersion(len(m1)) // create a new value
 	for k, v := range m1 {
 		m2[k] = v // copy all data from the current object to the new one
 	}
-	m.av.Store(m2) // atomically replace the current object with the new one
+	m.copied(len(m1))
+	delete(m2, key) // do the update that we need, never on the published m1
+	m.publish(m2)   // atomically replace the current object with the new one
+	if m.watching() {
+		m.notify(Event[K, V]{Kind: EventDelete, Key: key, Old: old, HadOld: true})
+	}
 	m.mu.Unlock()
 	// At this point all new readers start working with the new version.
 	// The old version will be garbage collected once the existing readers
@@ -67,44 +174,53 @@ func (m *Map) Delete(key string) {
 }
 
 // Tuple ...
-type Tuple struct {
-	Key   string
-	Value string
-}
+type Tuple[K comparable, V any] = cmap.Tuple[K, V]
 
 // Iter to use with a range loop
-func (m *Map) Iter() <-chan Tuple {
+//
+// Deprecated: use All, it needs neither a goroutine nor a channel buffer the
+// size of the map.
+func (m *Map[K, V]) Iter() <-chan Tuple[K, V] {
 
-	snap := m.av.Load().(innerMap)
+	snap := m.load().m
 	// Fully buffered, trade memory for speed baby!
-	ret := make(chan Tuple, len(snap))
+	ret := make(chan Tuple[K, V], len(snap))
 	go func() {
 		for k, v := range snap {
-			ret <- Tuple{k, v}
+			ret <- Tuple[K, V]{Key: k, Value: v}
 		}
 		close(ret)
 	}()
 	return ret
 }
 
-// Snapshot ...
-func (m *Map) Snapshot() map[string]string {
+// Snapshot returns a read-only View of the current version. It's free, as
+// it's the very map readers are using.
+func (m *Map[K, V]) Snapshot() View[K, V] {
 
-	return m.av.Load().(innerMap)
+	return View[K, V]{s: m.load()}
 }
 
 // Extend ...
-func (m *Map) Extend(e map[string]string) {
-	m.mu.Lock()                  // synchronize with other potential writers
-	m1 := m.av.Load().(innerMap) // load current value of the data structure
-	m2 := make(innerMap)         // create a new value
+func (m *Map[K, V]) Extend(e map[K]V) {
+	m.mu.Lock()                          // synchronize with other potential writers
+	m1 := m.load().m                     // load current value of the data structure
+	m2 := m.newVersion(len(m1) + len(e)) // create a new value
 	for k, v := range m1 {
 		m2[k] = v // copy all data from the current object to the new one
 	}
+	m.copied(len(m1))
+	var evs []Event[K, V]
+	watching := m.watching()
 	for k, v := range e {
+		if watching {
+			old, had := m2[k]
+			evs = append(evs, Event[K, V]{Kind: EventSet, Key: k, Old: old, HadOld: had, New: v})
+		}
 		m2[k] = v // copy all data from the e map too
 	}
-	m.av.Store(m2) // atomically replace the current object with the new one
+	m.publish(m2) // atomically replace the current object with the new one
+	m.notify(evs...)
 	m.mu.Unlock()
 	// At this point all new readers start working with the new version.
 	// The old version will be garbage collected once the existing readers
@@ -112,19 +228,178 @@ func (m *Map) Extend(e map[string]string) {
 }
 
 // ExtendSlice ...
-func (m *Map) ExtendSlice(e []Tuple) {
-	m.mu.Lock()                  // synchronize with other potential writers
-	m1 := m.av.Load().(innerMap) // load current value of the data structure
-	m2 := make(innerMap)         // create a new value
+func (m *Map[K, V]) ExtendSlice(e []Tuple[K, V]) {
+	m.mu.Lock()                          // synchronize with other potential writers
+	m1 := m.load().m                     // load current value of the data structure
+	m2 := m.newVersion(len(m1) + len(e)) // create a new value
 	for k, v := range m1 {
 		m2[k] = v // copy all data from the current object to the new one
 	}
+	m.copied(len(m1))
+	var evs []Event[K, V]
+	watching := m.watching()
 	for _, kv := range e {
+		if watching {
+			old, had := m2[kv.Key]
+			evs = append(evs, Event[K, V]{Kind: EventSet, Key: kv.Key, Old: old, HadOld: had, New: kv.Value})
+		}
 		m2[kv.Key] = kv.Value // copy all data from the e slice too
 	}
-	m.av.Store(m2) // atomically replace the current object with the new one
+	m.publish(m2) // atomically replace the current object with the new one
+	m.notify(evs...)
 	m.mu.Unlock()
 	// At this point all new readers start working with the new version.
 	// The old version will be garbage collected once the existing readers
 	// (if any) are done with it.
 }
+
+// Range calls f for every key and value until f returns false, like
+// sync.Map.Range. The published map is never mutated, so there's nothing to
+// copy and f is free to call back into the map.
+func (m *Map[K, V]) Range(f func(key K, value V) bool) {
+	for k, v := range m.load().m {
+		if !f(k, v) {
+			return
+		}
+	}
+}
+
+// All to use with a range-over-func loop. It walks the map published when the
+// loop starts, and breaking out early leaves nothing behind.
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	return m.Range
+}
+
+// Keys is like All, but only yields the keys.
+func (m *Map[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for k := range m.load().m {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+// Values is like All, but only yields the values.
+func (m *Map[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, v := range m.load().m {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// Tx is a batch of writes applied by Update. It's only valid inside the
+// Update callback.
+type Tx[K comparable, V any] struct {
+	m1       innerMap[K, V] // published map, never written to
+	m2       innerMap[K, V] // private copy, made on the first write
+	capacity int            // of the Map, for m2
+
+	watching bool
+	events   []Event[K, V]
+}
+
+func (tx *Tx[K, V]) cow() {
+	if tx.m2 != nil {
+		return
+	}
+	tx.m2 = make(innerMap[K, V], max(len(tx.m1)+1, tx.capacity))
+	for k, v := range tx.m1 {
+		tx.m2[k] = v
+	}
+}
+
+// Get sees the writes already made in this Tx.
+func (tx *Tx[K, V]) Get(key K) (V, bool) {
+	m := tx.m1
+	if tx.m2 != nil {
+		m = tx.m2
+	}
+	value, ok := m[key]
+	return value, ok
+}
+
+// Set ...
+func (tx *Tx[K, V]) Set(key K, value V) {
+	if tx.watching {
+		old, had := tx.Get(key)
+		tx.events = append(tx.events, Event[K, V]{Kind: EventSet, Key: key, Old: old, HadOld: had, New: value})
+	}
+	tx.cow()
+	tx.m2[key] = value
+}
+
+// Delete ...
+func (tx *Tx[K, V]) Delete(key K) {
+	old, ok := tx.Get(key)
+	if !ok {
+		return
+	}
+	if tx.watching {
+		tx.events = append(tx.events, Event[K, V]{Kind: EventDelete, Key: key, Old: old, HadOld: true})
+	}
+	tx.cow()
+	delete(tx.m2, key)
+}
+
+// Update runs f with a Tx and publishes all its writes at once, paying for a
+// single copy of the map however many writes f makes. Readers see either none
+// or all of them. If f makes no writes, or panics, nothing is published.
+func (m *Map[K, V]) Update(f func(tx *Tx[K, V])) {
+	m.mu.Lock() // synchronize with other potential writers
+	defer m.mu.Unlock()
+	tx := &Tx[K, V]{m1: m.load().m, capacity: m.capacity, watching: m.watching()}
+	f(tx)
+	if tx.m2 != nil {
+		m.copied(len(tx.m1))
+		m.publish(tx.m2) // atomically replace the current object with the new one
+		m.notify(tx.events...)
+	}
+}
+
+// WriteTo writes a checksummed binary snapshot of the map to w, in the
+// pkg/codec format. The published map never changes, so there's nothing to
+// copy or lock.
+func (m *Map[K, V]) WriteTo(w io.Writer) (int64, error) {
+	m1 := m.load().m
+	return codec.Encode(w, len(m1), func(yield func(K, V) bool) {
+		for k, v := range m1 {
+			if !yield(k, v) {
+				return
+			}
+		}
+	})
+}
+
+// ReadFrom replaces the contents of the map with a snapshot written by
+// WriteTo, published as a single new version. The snapshot is decoded and
+// verified in full first: on error the map is left as it was. Watchers get a
+// delete for every key that's gone and a set for every key in the snapshot.
+func (m *Map[K, V]) ReadFrom(r io.Reader) (int64, error) {
+	m2, n, err := codec.Decode[K, V](r)
+	if err != nil {
+		return n, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m1 := m.load().m
+	m.publish(m2)
+	if m.watching() {
+		var evs []Event[K, V]
+		for k, old := range m1 {
+			if _, ok := m2[k]; !ok {
+				evs = append(evs, Event[K, V]{Kind: EventDelete, Key: k, Old: old, HadOld: true})
+			}
+		}
+		for k, v := range m2 {
+			old, had := m1[k]
+			evs = append(evs, Event[K, V]{Kind: EventSet, Key: k, Old: old, HadOld: had, New: v})
+		}
+		m.notify(evs...)
+	}
+	return n, nil
+}
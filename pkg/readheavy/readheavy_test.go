@@ -0,0 +1,331 @@
+package readheavy
+
+import (
+	"bytes"
+	"maps"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+	"github.com/antoniomo/gobench/pkg/cmap/cmaptest"
+)
+
+// TestConformance's Concurrent case fails under -race if Delete goes back to
+// writing to the published map before copying it.
+func TestConformance(t *testing.T) {
+	cmaptest.Run(t, func() cmap.Map[string, string] { return New[string, string]().AsMap() })
+}
+
+// TestPublishedMapsAreImmutable runs lock-free readers against every kind of
+// writer. Readers copy a published map, keep reading it, and check it never
+// changes under them. Run it with -race: any write to a published map is also
+// reported as a race against the readers.
+func TestPublishedMapsAreImmutable(t *testing.T) {
+	const (
+		keys    = 200
+		rounds  = 200
+		readers = 4
+	)
+
+	m := New[string, string]()
+	for i := 0; i < keys; i++ {
+		m.Set(strconv.Itoa(i), "0")
+	}
+
+	var (
+		writers sync.WaitGroup
+		wg      sync.WaitGroup
+		done    = make(chan struct{})
+	)
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				snap := m.Snapshot()
+				want := snap.Clone()
+				for i := 0; i < keys; i++ {
+					m.Get(strconv.Itoa(i))
+				}
+				for k, v := range m.All() {
+					_, _ = k, v
+				}
+				if snap.Len() != len(want) {
+					t.Errorf("published map changed size: %d -> %d", len(want), snap.Len())
+					return
+				}
+				for k, v := range want {
+					if got, ok := snap.Get(k); !ok || got != v {
+						t.Errorf("published map changed: %q was %q, now %q, %v", k, v, got, ok)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	writer := func(f func(round int)) {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			for round := 0; round < rounds; round++ {
+				f(round)
+			}
+		}()
+	}
+	writer(func(round int) {
+		m.Set(strconv.Itoa(round%keys), strconv.Itoa(round))
+	})
+	writer(func(round int) {
+		m.Delete(strconv.Itoa((round * 7) % keys))
+	})
+	writer(func(round int) {
+		m.Extend(map[string]string{
+			strconv.Itoa((round * 3) % keys): strconv.Itoa(round),
+			strconv.Itoa((round * 5) % keys): strconv.Itoa(round),
+		})
+	})
+	writer(func(round int) {
+		m.ExtendSlice([]Tuple[string, string]{
+			{Key: strconv.Itoa((round * 11) % keys), Value: strconv.Itoa(round)},
+			{Key: strconv.Itoa((round * 13) % keys), Value: strconv.Itoa(round)},
+		})
+	})
+
+	writers.Wait()
+	close(done)
+	wg.Wait()
+}
+
+func TestUpdate(t *testing.T) {
+	m := New[string, string]()
+	m.Set("a", "1")
+	m.Set("b", "2")
+	before := m.Snapshot().Clone()
+
+	m.Update(func(tx *Tx[string, string]) {
+		tx.Set("c", "3")
+		tx.Delete("a")
+		tx.Delete("missing")
+		if v, ok := tx.Get("c"); !ok || v != "3" {
+			t.Errorf("tx.Get(c) = %q, %v; want \"3\", true", v, ok)
+		}
+		if _, ok := tx.Get("a"); ok {
+			t.Error("tx.Get(a) found a key deleted in the same Tx")
+		}
+		if _, ok := m.Get("c"); ok {
+			t.Error("Tx write visible before Update returned")
+		}
+	})
+
+	want := map[string]string{"b": "2", "c": "3"}
+	got := m.Snapshot().Clone()
+	if len(got) != len(want) || got["b"] != "2" || got["c"] != "3" {
+		t.Fatalf("Snapshot() = %v; want %v", got, want)
+	}
+	if len(before) != 2 || before["a"] != "1" {
+		t.Fatalf("Update changed an earlier snapshot: %v", before)
+	}
+}
+
+func TestUpdatePanicPublishesNothing(t *testing.T) {
+	m := New[string, string]()
+	m.Set("a", "1")
+	func() {
+		defer func() { recover() }()
+		m.Update(func(tx *Tx[string, string]) {
+			tx.Set("a", "2")
+			panic("boom")
+		})
+	}()
+	if v, _ := m.Get("a"); v != "1" {
+		t.Fatalf("Get(a) = %q after a panicking Update; want \"1\"", v)
+	}
+	m.Set("b", "1") // the writer lock was released
+}
+
+func TestCoalescer(t *testing.T) {
+	m := New[string, string]()
+	c := NewCoalescer(m, 0, 0) // only explicit flushes
+	c.Set("a", "1")
+	c.Set("b", "1")
+	c.Delete("a")
+	c.Set("b", "2")
+	if _, ok := m.Get("b"); ok {
+		t.Fatal("buffered write visible before Flush")
+	}
+	c.Flush()
+	if _, ok := m.Get("a"); ok {
+		t.Fatal("Get(a) found a key deleted in the batch")
+	}
+	if v, _ := m.Get("b"); v != "2" {
+		t.Fatalf("Get(b) = %q; want the last buffered write, \"2\"", v)
+	}
+
+	c.Set("c", "1")
+	c.Close()
+	if _, ok := m.Get("c"); !ok {
+		t.Fatal("Close didn't flush the buffered writes")
+	}
+	c.Set("d", "1")
+	if _, ok := m.Get("d"); !ok {
+		t.Fatal("write after Close wasn't applied")
+	}
+}
+
+func TestCoalescerBatchSize(t *testing.T) {
+	m := New[string, string]()
+	c := NewCoalescer(m, time.Hour, 10)
+	defer c.Close()
+	for i := 0; i < 10; i++ {
+		c.Set(strconv.Itoa(i), "x")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Snapshot().Len() != 10 {
+		if time.Now().After(deadline) {
+			t.Fatal("full batch wasn't flushed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCoalescerInterval(t *testing.T) {
+	m := New[string, string]()
+	c := NewCoalescer(m, time.Millisecond, 0)
+	defer c.Close()
+	c.Set("a", "1")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := m.Get("a"); ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("buffered write wasn't flushed on the interval")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestVersionedConformance(t *testing.T) {
+	cmaptest.RunVersioned(t, func() cmap.VersionedMap[string, string] { return New[string, string]().AsMap() })
+}
+
+func TestView(t *testing.T) {
+	m := New[string, string]()
+	m.Set("a", "1")
+	m.Set("b", "2")
+	v := m.Snapshot()
+	m.Set("a", "3")
+	m.Delete("b")
+
+	if v.Len() != 2 || v.Version() != 2 {
+		t.Fatalf("Len() = %d, Version() = %d; want 2, 2", v.Len(), v.Version())
+	}
+	if got, ok := v.Get("a"); !ok || got != "1" {
+		t.Fatalf("Get(a) = %q, %v; want \"1\", true", got, ok)
+	}
+	keys := 0
+	for range v.Keys() {
+		keys++
+	}
+	if keys != 2 {
+		t.Fatalf("Keys yielded %d keys; want 2", keys)
+	}
+
+	c := v.Clone()
+	c["a"] = "x" // ours to write to
+	if got, _ := v.Get("a"); got != "1" {
+		t.Fatal("writing to a Clone changed the View")
+	}
+	if got, _ := m.Get("a"); got != "3" {
+		t.Fatal("writing to a Clone changed the Map")
+	}
+}
+
+func TestWriteToReadFrom(t *testing.T) {
+	m := New[string, string]()
+	m.Set("a", "1")
+	m.Set("b", "2")
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	snap := buf.Bytes()
+
+	r := New[string, string]()
+	r.Set("a", "0")
+	r.Set("c", "3")
+	s := r.WatchAll(10, Drop)
+	defer s.Cancel()
+
+	// A corrupt snapshot changes nothing.
+	bad := bytes.Clone(snap)
+	bad[len(bad)-1] ^= 1
+	if _, err := r.ReadFrom(bytes.NewReader(bad)); err == nil {
+		t.Fatal("ReadFrom accepted a corrupt snapshot")
+	}
+	if r.Version() != 2 {
+		t.Fatalf("Version() = %d after a failed ReadFrom; want 2", r.Version())
+	}
+
+	if _, err := r.ReadFrom(bytes.NewReader(snap)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.Snapshot().Clone(), m.Snapshot().Clone(); !maps.Equal(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if r.Version() != 3 {
+		t.Fatalf("Version() = %d; want 3, one publish for the whole snapshot", r.Version())
+	}
+
+	evs := map[string]Event[string, string]{}
+	for range 3 {
+		ev := recv(t, s)
+		evs[ev.Key] = ev
+	}
+	want := map[string]Event[string, string]{
+		"a": {Kind: EventSet, Key: "a", Old: "0", HadOld: true, New: "1", Version: 3},
+		"b": {Kind: EventSet, Key: "b", New: "2", Version: 3},
+		"c": {Kind: EventDelete, Key: "c", Old: "3", HadOld: true, Version: 3},
+	}
+	if !maps.Equal(evs, want) {
+		t.Fatalf("got events %+v; want %+v", evs, want)
+	}
+	noEvent(t, s)
+}
+
+func TestLenClear(t *testing.T) {
+	m := NewWithCapacity[string, string](10)
+	m.Set("a", "1")
+	m.Set("b", "2")
+	if n := m.Len(); n != 2 {
+		t.Fatalf("Len() = %d; want 2", n)
+	}
+	v := m.Snapshot()
+	s := m.Watch("a", 1, Drop)
+	defer s.Cancel()
+
+	m.Clear()
+	if n := m.Len(); n != 0 {
+		t.Fatalf("Len() = %d after Clear; want 0", n)
+	}
+	if v.Len() != 2 {
+		t.Fatal("Clear changed a View of the previous version")
+	}
+	want := Event[string, string]{Kind: EventDelete, Key: "a", Old: "1", HadOld: true, Version: 3}
+	if ev := recv(t, s); ev != want {
+		t.Fatalf("got %+v; want %+v", ev, want)
+	}
+
+	m.Clear() // already empty, publishes nothing
+	if m.Version() != 3 {
+		t.Fatalf("Version() = %d after clearing an empty map; want 3", m.Version())
+	}
+}
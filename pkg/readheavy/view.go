@@ -0,0 +1,70 @@
+package readheavy
+
+import (
+	"iter"
+	"maps"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+)
+
+// View is a read-only snapshot of a Map. It wraps the published map itself,
+// so it's free to take and safe to hand to code we don't control: there's no
+// way to write to it. Use Clone to get a copy that can be written to.
+type View[K comparable, V any] struct {
+	s *state[K, V]
+}
+
+// Version of the Map this View was taken at.
+func (v View[K, V]) Version() uint64 {
+	return v.s.version
+}
+
+// Get ...
+func (v View[K, V]) Get(key K) (V, bool) {
+	value, ok := v.s.m[key]
+	return value, ok
+}
+
+// Len ...
+func (v View[K, V]) Len() int {
+	return len(v.s.m)
+}
+
+// Range calls f for every key and value until f returns false.
+func (v View[K, V]) Range(f func(key K, value V) bool) {
+	for k, value := range v.s.m {
+		if !f(k, value) {
+			return
+		}
+	}
+}
+
+// All ...
+func (v View[K, V]) All() iter.Seq2[K, V] {
+	return v.Range
+}
+
+// Keys ...
+func (v View[K, V]) Keys() iter.Seq[K] {
+	return maps.Keys(v.s.m)
+}
+
+// Clone copies the View into a map of our own.
+func (v View[K, V]) Clone() map[K]V {
+	return maps.Clone(map[K]V(v.s.m))
+}
+
+// stdMap adapts a Map to cmap.Map, whose Snapshot returns a plain map.
+type stdMap[K comparable, V any] struct {
+	*Map[K, V]
+}
+
+func (m stdMap[K, V]) Snapshot() map[K]V {
+	return m.Map.Snapshot().Clone()
+}
+
+// AsMap adapts m to cmap.Map, to use it along the other maps. The adapter's
+// Snapshot pays for a Clone.
+func (m *Map[K, V]) AsMap() cmap.VersionedMap[K, V] {
+	return stdMap[K, V]{m}
+}
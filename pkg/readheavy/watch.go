@@ -0,0 +1,180 @@
+package readheavy
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// EventKind ...
+type EventKind int
+
+const (
+	// EventSet is sent for Set, and for every key written by Extend,
+	// ExtendSlice and Update.
+	EventSet EventKind = iota
+	// EventDelete is sent when a key that was there gets deleted.
+	EventDelete
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventSet:
+		return "set"
+	case EventDelete:
+		return "delete"
+	}
+	return "EventKind(?)"
+}
+
+// Event describes a change to a single key.
+type Event[K comparable, V any] struct {
+	Kind EventKind
+	Key  K
+	// Old is the value before the change, if HadOld.
+	Old    V
+	HadOld bool
+	// New is the value after an EventSet.
+	New V
+	// Version of the map that has the change. Every published change bumps
+	// it, and all the events of a single Extend, ExtendSlice or Update share
+	// it.
+	Version uint64
+}
+
+// WatchPolicy says what to do when a subscriber's buffer is full.
+type WatchPolicy int
+
+const (
+	// Drop discards the event and counts it in Dropped. Writers never wait.
+	Drop WatchPolicy = iota
+	// Block makes the writer wait until the subscriber catches up or
+	// cancels. Every writer waits with it, so use it with care.
+	Block
+)
+
+// Subscription delivers the events of a Watch or WatchAll on C, in order.
+// Events are sent by the writers themselves, there are no goroutines behind a
+// Subscription.
+type Subscription[K comparable, V any] struct {
+	// C is closed after Cancel.
+	C <-chan Event[K, V]
+
+	c       chan Event[K, V]
+	m       *Map[K, V]
+	key     K
+	all     bool
+	policy  WatchPolicy
+	dropped atomic.Uint64
+
+	done       chan struct{}
+	cancelOnce sync.Once
+}
+
+type subs[K comparable, V any] map[*Subscription[K, V]]struct{}
+
+type watchers[K comparable, V any] struct {
+	byKey map[K]subs[K, V]
+	all   subs[K, V]
+}
+
+// Watch subscribes to changes to key, with room for buffer pending events.
+func (m *Map[K, V]) Watch(key K, buffer int, policy WatchPolicy) *Subscription[K, V] {
+	s := newSubscription(m, buffer, policy)
+	s.key = key
+	m.mu.Lock()
+	if m.watchers.byKey == nil {
+		m.watchers.byKey = make(map[K]subs[K, V])
+	}
+	if m.watchers.byKey[key] == nil {
+		m.watchers.byKey[key] = make(subs[K, V])
+	}
+	m.watchers.byKey[key][s] = struct{}{}
+	m.mu.Unlock()
+	return s
+}
+
+// WatchAll subscribes to changes to every key, with room for buffer pending
+// events.
+func (m *Map[K, V]) WatchAll(buffer int, policy WatchPolicy) *Subscription[K, V] {
+	s := newSubscription(m, buffer, policy)
+	s.all = true
+	m.mu.Lock()
+	if m.watchers.all == nil {
+		m.watchers.all = make(subs[K, V])
+	}
+	m.watchers.all[s] = struct{}{}
+	m.mu.Unlock()
+	return s
+}
+
+func newSubscription[K comparable, V any](m *Map[K, V], buffer int, policy WatchPolicy) *Subscription[K, V] {
+	c := make(chan Event[K, V], buffer)
+	return &Subscription[K, V]{
+		C:      c,
+		c:      c,
+		m:      m,
+		policy: policy,
+		done:   make(chan struct{}),
+	}
+}
+
+// Cancel stops the subscription and closes C. A writer blocked on it is
+// released right away. It's safe to call more than once.
+func (s *Subscription[K, V]) Cancel() {
+	s.cancelOnce.Do(func() {
+		close(s.done) // unblock a writer waiting on us, it holds mu
+		m := s.m
+		m.mu.Lock()
+		if s.all {
+			delete(m.watchers.all, s)
+		} else {
+			delete(m.watchers.byKey[s.key], s)
+			if len(m.watchers.byKey[s.key]) == 0 {
+				delete(m.watchers.byKey, s.key)
+			}
+		}
+		m.mu.Unlock()
+		// Events are only sent with mu held, so nothing can send on c now.
+		close(s.c)
+	})
+}
+
+// Dropped is the number of events discarded because C was full.
+func (s *Subscription[K, V]) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+func (s *Subscription[K, V]) send(ev Event[K, V]) {
+	if s.policy == Block {
+		select {
+		case s.c <- ev:
+		case <-s.done:
+		}
+		return
+	}
+	select {
+	case s.c <- ev:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// watching must be called with mu held.
+func (m *Map[K, V]) watching() bool {
+	return len(m.watchers.all) > 0 || len(m.watchers.byKey) > 0
+}
+
+// notify stamps evs with the current version and sends them out. It must be
+// called with mu held, after the change is published.
+func (m *Map[K, V]) notify(evs ...Event[K, V]) {
+	version := m.load().version
+	for _, ev := range evs {
+		ev.Version = version
+		for s := range m.watchers.byKey[ev.Key] {
+			s.send(ev)
+		}
+		for s := range m.watchers.all {
+			s.send(ev)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package readheavy
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func recv(t *testing.T, s *Subscription[string, string]) Event[string, string] {
+	t.Helper()
+	select {
+	case ev := <-s.C:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+	panic("unreachable")
+}
+
+func noEvent(t *testing.T, s *Subscription[string, string]) {
+	t.Helper()
+	select {
+	case ev := <-s.C:
+		t.Fatalf("unexpected event %+v", ev)
+	default:
+	}
+}
+
+func TestWatch(t *testing.T) {
+	m := New[string, string]()
+	s := m.Watch("a", 10, Drop)
+	defer s.Cancel()
+
+	m.Set("b", "1") // not ours
+	m.Set("a", "1")
+	m.Set("a", "2")
+	m.Delete("a")
+	m.Delete("a") // wasn't there, no event
+
+	want := []Event[string, string]{
+		{Kind: EventSet, Key: "a", New: "1", Version: 2},
+		{Kind: EventSet, Key: "a", Old: "1", HadOld: true, New: "2", Version: 3},
+		{Kind: EventDelete, Key: "a", Old: "2", HadOld: true, Version: 4},
+	}
+	for _, w := range want {
+		if ev := recv(t, s); ev != w {
+			t.Fatalf("got %+v; want %+v", ev, w)
+		}
+	}
+	noEvent(t, s)
+}
+
+func TestWatchAllBatches(t *testing.T) {
+	m := New[string, string]()
+	m.Set("x", "0")
+	s := m.WatchAll(10, Drop)
+	defer s.Cancel()
+
+	m.Extend(map[string]string{"x": "1"})
+	m.ExtendSlice([]Tuple[string, string]{{Key: "y", Value: "1"}, {Key: "y", Value: "2"}})
+	m.Update(func(tx *Tx[string, string]) {
+		tx.Set("z", "1")
+		tx.Delete("x")
+	})
+
+	want := []Event[string, string]{
+		{Kind: EventSet, Key: "x", Old: "0", HadOld: true, New: "1", Version: 2},
+		{Kind: EventSet, Key: "y", New: "1", Version: 3},
+		{Kind: EventSet, Key: "y", Old: "1", HadOld: true, New: "2", Version: 3},
+		{Kind: EventSet, Key: "z", New: "1", Version: 4},
+		{Kind: EventDelete, Key: "x", Old: "1", HadOld: true, Version: 4},
+	}
+	for _, w := range want {
+		if ev := recv(t, s); ev != w {
+			t.Fatalf("got %+v; want %+v", ev, w)
+		}
+	}
+	noEvent(t, s)
+}
+
+func TestWatchDrop(t *testing.T) {
+	m := New[string, string]()
+	s := m.WatchAll(1, Drop)
+	defer s.Cancel()
+	m.Set("a", "1")
+	m.Set("a", "2")
+	m.Set("a", "3")
+	if ev := recv(t, s); ev.New != "1" {
+		t.Fatalf("got %+v; want the first event", ev)
+	}
+	if n := s.Dropped(); n != 2 {
+		t.Fatalf("Dropped() = %d; want 2", n)
+	}
+}
+
+func TestWatchBlockCancel(t *testing.T) {
+	m := New[string, string]()
+	s := m.WatchAll(0, Block)
+
+	done := make(chan struct{})
+	go func() {
+		m.Set("a", "1") // nobody's reading, blocks
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Set didn't block on a full Block subscriber")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	s.Cancel()
+	<-done
+	if _, ok := <-s.C; ok {
+		t.Fatal("C still open after Cancel")
+	}
+	m.Set("a", "2") // doesn't block anymore
+	s.Cancel()
+}
+
+func TestWatchCancelLeavesNothingBehind(t *testing.T) {
+	m := New[string, string]()
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		m.Watch("a", 1, Block).Cancel()
+		m.WatchAll(1, Drop).Cancel()
+	}
+	if m.watching() {
+		t.Fatal("cancelled subscriptions still registered")
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("%d goroutines before, %d after", before, after)
+	}
+}
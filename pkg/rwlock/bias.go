@@ -0,0 +1,95 @@
+package rwlock
+
+import (
+	"math/rand/v2"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// readerBias is a BRAVO style reader indicator (Dice and Kogan, "BRAVO:
+// Biased Locking for Reader-Writer Locks") in front of the map's RWMutex.
+//
+// Every sync.RWMutex.RLock adds to the same reader count, so readers on
+// different cores keep stealing its cache line from each other. While the
+// bias is on, readers announce themselves in a slot picked at random
+// instead, and never touch the mutex. A writer takes the mutex, turns the
+// bias off and waits for the slots to empty. Turning it off is slow, so it
+// stays off for a while after every writer, in proportion to how long the
+// writer had to wait: the bias pays off for read mostly maps and gets out of
+// the way of the rest.
+type readerBias struct {
+	on           atomic.Bool
+	inhibitUntil atomic.Int64 // UnixNano, bias stays off until then
+	slots        []slot
+}
+
+// slot is padded to its own cache line, or neighbouring slots would bounce
+// it just like the mutex does.
+type slot struct {
+	readers atomic.Int32
+	_       [60]byte
+}
+
+// inhibitFactor is how many times the revocation time the bias stays off,
+// the paper's N.
+const inhibitFactor = 9
+
+// noSlot is the rlock token of a reader that took the mutex.
+const noSlot = -1
+
+func newReaderBias() *readerBias {
+	n := 1
+	for n < 4*runtime.GOMAXPROCS(0) {
+		n <<= 1
+	}
+	rb := &readerBias{slots: make([]slot, n)}
+	rb.on.Store(true)
+	return rb
+}
+
+// tryRLock takes a slot, if the bias is on.
+func (rb *readerBias) tryRLock() (int, bool) {
+	if !rb.on.Load() {
+		return noSlot, false
+	}
+	i := int(rand.Uint32() & uint32(len(rb.slots)-1))
+	s := &rb.slots[i].readers
+	s.Add(1)
+	// A writer turns the bias off before it checks the slots, so either it
+	// sees us, or we see it.
+	if rb.on.Load() {
+		return i, true
+	}
+	s.Add(-1)
+	return noSlot, false
+}
+
+func (rb *readerBias) runlock(i int) {
+	rb.slots[i].readers.Add(-1)
+}
+
+// rearm turns the bias back on once the inhibition is over. It must be
+// called with the mutex read locked, so that no writer is revoking it.
+func (rb *readerBias) rearm() {
+	if !rb.on.Load() && time.Now().UnixNano() >= rb.inhibitUntil.Load() {
+		rb.on.Store(true)
+	}
+}
+
+// revoke turns the bias off and waits for the readers in slots to leave. It
+// must be called with the mutex write locked.
+func (rb *readerBias) revoke() {
+	if !rb.on.Load() {
+		return
+	}
+	rb.on.Store(false)
+	start := time.Now()
+	for i := range rb.slots {
+		for rb.slots[i].readers.Load() != 0 {
+			runtime.Gosched()
+		}
+	}
+	now := time.Now()
+	rb.inhibitUntil.Store(now.UnixNano() + inhibitFactor*int64(now.Sub(start)))
+}
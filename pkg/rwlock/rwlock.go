@@ -1,55 +1,149 @@
 package rwlock
 
-import "sync"
+import (
+	"io"
+	"iter"
+	"sync"
+	"time"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+	"github.com/antoniomo/gobench/pkg/codec"
+)
 
 // Map ...
-type Map struct {
+type Map[K comparable, V any] struct {
 	mu sync.RWMutex
-	m  map[string]string
+	m  map[K]V
+	// version is bumped on every write, guarded by mu.
+	version uint64
+
+	bias *readerBias // nil unless NewReaderBiased
 }
 
 // New ...
-func New() *Map {
-	return &Map{m: make(map[string]string)}
+func New[K comparable, V any]() *Map[K, V] {
+	return &Map[K, V]{m: make(map[K]V)}
+}
+
+// NewReaderBiased is New with a reader biased lock, that lets readers on
+// different cores run without contending on a shared reader count, at the
+// expense of writers. It pays off for maps that are read far more than they
+// are written, by many cores at once.
+func NewReaderBiased[K comparable, V any]() *Map[K, V] {
+	return &Map[K, V]{m: make(map[K]V), bias: newReaderBias()}
+}
+
+// NewWithCapacity is New with room for capacity entries before the map has to
+// grow.
+func NewWithCapacity[K comparable, V any](capacity int) *Map[K, V] {
+	return &Map[K, V]{m: make(map[K]V, capacity)}
+}
+
+// NewReaderBiasedWithCapacity is NewReaderBiased with room for capacity
+// entries before the map has to grow.
+func NewReaderBiasedWithCapacity[K comparable, V any](capacity int) *Map[K, V] {
+	return &Map[K, V]{m: make(map[K]V, capacity), bias: newReaderBias()}
 }
 
 // Get ...
-func (m *Map) Get(key string) (string, bool) {
-	m.mu.RLock()
+func (m *Map[K, V]) Get(key K) (V, bool) {
+	tok := m.rlock()
 	value, ok := m.m[key]
-	m.mu.RUnlock()
+	m.runlock(tok)
 	return value, ok
 }
 
 // Set ...
-func (m *Map) Set(key, value string) {
-	m.mu.Lock()
+func (m *Map[K, V]) Set(key K, value V) {
+	m.lock()
 	m.m[key] = value
+	m.version++
 	m.mu.Unlock()
 }
 
 // Delete ...
-func (m *Map) Delete(key string) {
-	m.mu.Lock()
-	delete(m.m, key)
+func (m *Map[K, V]) Delete(key K) {
+	m.lock()
+	if _, ok := m.m[key]; ok {
+		delete(m.m, key)
+		m.version++
+	}
 	m.mu.Unlock()
 }
 
-// Tuple ...
-type Tuple struct {
-	Key   string
-	Value string
+// GetMany is Get for every key, under a single lock acquisition. The results
+// are in the same order as keys.
+func (m *Map[K, V]) GetMany(keys []K) []Result[V] {
+	ret := make([]Result[V], len(keys))
+	tok := m.rlock()
+	for i, k := range keys {
+		ret[i].Value, ret[i].Ok = m.m[k]
+	}
+	m.runlock(tok)
+	return ret
+}
+
+// SetMany is Set for every tuple, in order, under a single lock acquisition.
+func (m *Map[K, V]) SetMany(e []Tuple[K, V]) {
+	m.lock()
+	for _, kv := range e {
+		m.m[kv.Key] = kv.Value
+	}
+	if len(e) > 0 {
+		m.version++
+	}
+	m.mu.Unlock()
 }
 
+// DeleteMany is Delete for every key, under a single lock acquisition.
+func (m *Map[K, V]) DeleteMany(keys []K) {
+	m.lock()
+	n := len(m.m)
+	for _, k := range keys {
+		delete(m.m, k)
+	}
+	if len(m.m) != n {
+		m.version++
+	}
+	m.mu.Unlock()
+}
+
+// Len ...
+func (m *Map[K, V]) Len() int {
+	tok := m.rlock()
+	n := len(m.m)
+	m.runlock(tok)
+	return n
+}
+
+// Clear deletes every entry, keeping the memory the map has grown to.
+func (m *Map[K, V]) Clear() {
+	m.lock()
+	if len(m.m) > 0 {
+		clear(m.m)
+		m.version++
+	}
+	m.mu.Unlock()
+}
+
+// Tuple ...
+type Tuple[K comparable, V any] = cmap.Tuple[K, V]
+
+// Result ...
+type Result[V any] = cmap.Result[V]
+
 // Iter to use with a range loop
-func (m *Map) Iter() <-chan Tuple {
+//
+// Deprecated: use All, it needs neither a goroutine nor a channel buffer the
+// size of the map.
+func (m *Map[K, V]) Iter() <-chan Tuple[K, V] {
 
 	snap := m.Snapshot()
 	// Fully buffered, trade memory for speed baby!
-	ret := make(chan Tuple, len(snap))
+	ret := make(chan Tuple[K, V], len(snap))
 	go func() {
 		for k, v := range snap {
-			ret <- Tuple{k, v}
+			ret <- Tuple[K, V]{Key: k, Value: v}
 		}
 		close(ret)
 	}()
@@ -57,11 +151,13 @@ func (m *Map) Iter() <-chan Tuple {
 }
 
 // IterSlice to use with a range loop (with slice snapshot)
-func (m *Map) IterSlice() <-chan Tuple {
+//
+// Deprecated: use All.
+func (m *Map[K, V]) IterSlice() <-chan Tuple[K, V] {
 
 	snap := m.SliceSnapshot()
 	// Fully buffered, trade memory for speed baby!
-	ret := make(chan Tuple, len(snap))
+	ret := make(chan Tuple[K, V], len(snap))
 	go func() {
 		for _, v := range snap {
 			ret <- v
@@ -72,26 +168,262 @@ func (m *Map) IterSlice() <-chan Tuple {
 }
 
 // Snapshot ...
-func (m *Map) Snapshot() map[string]string {
+func (m *Map[K, V]) Snapshot() map[K]V {
 
-	ret := make(map[string]string)
-	m.mu.RLock()
+	ret := make(map[K]V)
+	tok := m.rlock()
 	for k, v := range m.m {
 		ret[k] = v
 	}
-	m.mu.RUnlock()
+	m.runlock(tok)
+	return ret
+}
+
+// VersionedSnapshot is Snapshot tagged with its version, read atomically
+// together.
+func (m *Map[K, V]) VersionedSnapshot() cmap.Versioned[K, V] {
+
+	tok := m.rlock()
+	ret := cmap.Versioned[K, V]{Version: m.version, Map: make(map[K]V, len(m.m))}
+	for k, v := range m.m {
+		ret.Map[k] = v
+	}
+	m.runlock(tok)
 	return ret
 }
 
 // SliceSnapshot ...
-func (m *Map) SliceSnapshot() []Tuple {
+func (m *Map[K, V]) SliceSnapshot() []Tuple[K, V] {
 	i := 0
-	m.mu.RLock()
-	ret := make([]Tuple, len(m.m))
+	tok := m.rlock()
+	ret := make([]Tuple[K, V], len(m.m))
 	for k, v := range m.m {
-		ret[i] = Tuple{k, v}
+		ret[i] = Tuple[K, V]{Key: k, Value: v}
 		i++
 	}
-	m.mu.RUnlock()
+	m.runlock(tok)
 	return ret
 }
+
+// Range calls f for every key and value until f returns false, like
+// sync.Map.Range. It walks a snapshot, so f is free to call back into the map.
+func (m *Map[K, V]) Range(f func(key K, value V) bool) {
+	for _, kv := range m.SliceSnapshot() {
+		if !f(kv.Key, kv.Value) {
+			return
+		}
+	}
+}
+
+// All to use with a range-over-func loop. The snapshot is taken when the loop
+// starts, and breaking out early leaves nothing behind.
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	return m.Range
+}
+
+// Keys is like All, but only snapshots and yields the keys.
+func (m *Map[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		tok := m.rlock()
+		keys := make([]K, 0, len(m.m))
+		for k := range m.m {
+			keys = append(keys, k)
+		}
+		m.runlock(tok)
+		for _, k := range keys {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+// Values is like All, but only snapshots and yields the values.
+func (m *Map[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		tok := m.rlock()
+		values := make([]V, 0, len(m.m))
+		for _, v := range m.m {
+			values = append(values, v)
+		}
+		m.runlock(tok)
+		for _, v := range values {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// LoadOrStore returns the existing value for key if there is one. Otherwise
+// it stores value and returns it. loaded is true if the value was there.
+func (m *Map[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	m.lock()
+	actual, loaded = m.m[key]
+	if !loaded {
+		m.m[key] = value
+		m.version++
+		actual = value
+	}
+	m.mu.Unlock()
+	return actual, loaded
+}
+
+// LoadAndDelete deletes key, returning its previous value if there was one.
+func (m *Map[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	m.lock()
+	value, loaded = m.m[key]
+	if loaded {
+		delete(m.m, key)
+		m.version++
+	}
+	m.mu.Unlock()
+	return value, loaded
+}
+
+// Swap stores value for key, returning the previous value if there was one.
+func (m *Map[K, V]) Swap(key K, value V) (previous V, loaded bool) {
+	m.lock()
+	previous, loaded = m.m[key]
+	m.m[key] = value
+	m.version++
+	m.mu.Unlock()
+	return previous, loaded
+}
+
+// CompareAndSwap stores new for key only if its current value equals old. As
+// with sync.Map, it panics if V isn't comparable at run time.
+func (m *Map[K, V]) CompareAndSwap(key K, old, new V) (swapped bool) {
+	m.lock()
+	cur, ok := m.m[key]
+	if ok && any(cur) == any(old) {
+		m.m[key] = new
+		m.version++
+		swapped = true
+	}
+	m.mu.Unlock()
+	return swapped
+}
+
+// CompareAndDelete deletes key only if its current value equals old. As with
+// sync.Map, it panics if V isn't comparable at run time.
+func (m *Map[K, V]) CompareAndDelete(key K, old V) (deleted bool) {
+	m.lock()
+	cur, ok := m.m[key]
+	if ok && any(cur) == any(old) {
+		delete(m.m, key)
+		m.version++
+		deleted = true
+	}
+	m.mu.Unlock()
+	return deleted
+}
+
+// Update calls f with the current value for key, if any, and stores what f
+// returns, or deletes key if f returns false. It all happens under one lock,
+// so no other writer can get in between the read and the write. f must not
+// call back into the map.
+func (m *Map[K, V]) Update(key K, f func(old V, ok bool) (V, bool)) (V, bool) {
+	m.lock()
+	defer m.mu.Unlock() // f may panic
+	old, ok := m.m[key]
+	value, keep := f(old, ok)
+	if keep {
+		m.m[key] = value
+		m.version++
+	} else if ok {
+		delete(m.m, key)
+		m.version++
+	}
+	return value, keep
+}
+
+// WriteTo writes a checksummed binary snapshot of the map to w, in the
+// pkg/codec format. The map is copied first, so writers aren't held up by a
+// slow w.
+func (m *Map[K, V]) WriteTo(w io.Writer) (int64, error) {
+	snap := m.SliceSnapshot()
+	return codec.Encode(w, len(snap), func(yield func(K, V) bool) {
+		for _, t := range snap {
+			if !yield(t.Key, t.Value) {
+				return
+			}
+		}
+	})
+}
+
+// ReadFrom replaces the contents of the map with a snapshot written by
+// WriteTo. The snapshot is decoded and verified in full first: on error the
+// map is left as it was.
+func (m *Map[K, V]) ReadFrom(r io.Reader) (int64, error) {
+	loaded, n, err := codec.Decode[K, V](r)
+	if err != nil {
+		return n, err
+	}
+	m.lock()
+	m.m = loaded
+	m.version++
+	m.mu.Unlock()
+	return n, nil
+}
+
+// WaitLock takes the write lock and lets it go, returning how long it had to
+// wait for it, or 0 if it was free. It's for metrics.Wrap to time lock waits
+// on a sample of operations, so that the others don't pay for it. It doesn't
+// revoke a reader bias, so readers holding a biased slot aren't waited for.
+func (m *Map[K, V]) WaitLock() time.Duration {
+	if m.mu.TryLock() {
+		m.mu.Unlock()
+		return 0
+	}
+	start := time.Now()
+	m.mu.Lock()
+	m.mu.Unlock()
+	return time.Since(start)
+}
+
+// WaitRLock is WaitLock for the read lock.
+func (m *Map[K, V]) WaitRLock() time.Duration {
+	if m.mu.TryRLock() {
+		m.mu.RUnlock()
+		return 0
+	}
+	start := time.Now()
+	m.mu.RLock()
+	m.mu.RUnlock()
+	return time.Since(start)
+}
+
+func (m *Map[K, V]) lock() {
+	m.mu.Lock()
+	m.revokeBias()
+}
+
+// revokeBias must be called with mu write locked.
+func (m *Map[K, V]) revokeBias() {
+	if m.bias != nil {
+		m.bias.revoke()
+	}
+}
+
+// rlock returns the token to pass to runlock.
+func (m *Map[K, V]) rlock() int {
+	if m.bias != nil {
+		if i, ok := m.bias.tryRLock(); ok {
+			return i
+		}
+	}
+	m.mu.RLock()
+	if m.bias != nil {
+		m.bias.rearm()
+	}
+	return noSlot
+}
+
+func (m *Map[K, V]) runlock(tok int) {
+	if tok != noSlot {
+		m.bias.runlock(tok)
+		return
+	}
+	m.mu.RUnlock()
+}
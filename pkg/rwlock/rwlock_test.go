@@ -0,0 +1,165 @@
+package rwlock
+
+import (
+	"bytes"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+	"github.com/antoniomo/gobench/pkg/cmap/cmaptest"
+)
+
+func TestConformance(t *testing.T) {
+	cmaptest.Run(t, func() cmap.Map[string, string] { return New[string, string]() })
+}
+
+func TestReaderBiasedConformance(t *testing.T) {
+	cmaptest.Run(t, func() cmap.Map[string, string] { return NewReaderBiased[string, string]() })
+	cmaptest.RunAtomic(t, func() cmap.AtomicMap[string, int] { return NewReaderBiased[string, int]() })
+}
+
+func TestAtomicConformance(t *testing.T) {
+	cmaptest.RunAtomic(t, func() cmap.AtomicMap[string, int] { return New[string, int]() })
+}
+
+func TestVersionedConformance(t *testing.T) {
+	cmaptest.RunVersioned(t, func() cmap.VersionedMap[string, string] { return New[string, string]() })
+}
+
+func TestWriteToReadFrom(t *testing.T) {
+	m := New[string, int]()
+	for i, k := range []string{"a", "b", "c"} {
+		m.Set(k, i)
+	}
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	r := New[string, int]()
+	r.Set("stale", 1)
+	if _, err := r.ReadFrom(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); err == nil {
+		t.Fatal("ReadFrom accepted a truncated snapshot")
+	}
+	if _, ok := r.Get("stale"); !ok {
+		t.Fatal("a failed ReadFrom changed the map")
+	}
+	if _, err := r.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.Snapshot(), m.Snapshot(); !maps.Equal(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func TestBulk(t *testing.T) {
+	m := New[string, int]()
+	m.SetMany([]Tuple[string, int]{{Key: "a", Value: 1}, {Key: "b", Value: 2}, {Key: "a", Value: 3}})
+	got := m.GetMany([]string{"a", "b", "c"})
+	want := []Result[int]{{Value: 3, Ok: true}, {Value: 2, Ok: true}, {}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("GetMany = %v; want %v", got, want)
+	}
+
+	m.DeleteMany([]string{"a", "c"})
+	got = m.GetMany([]string{"a", "b"})
+	want = []Result[int]{{}, {Value: 2, Ok: true}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("GetMany after DeleteMany = %v; want %v", got, want)
+	}
+	if v := m.VersionedSnapshot().Version; v != 2 {
+		t.Fatalf("Version = %d; want 2, one per batch", v)
+	}
+	m.DeleteMany([]string{"a", "c"})
+	m.SetMany(nil)
+	if v := m.VersionedSnapshot().Version; v != 2 {
+		t.Fatalf("Version = %d after batches that changed nothing; want 2", v)
+	}
+}
+
+func TestLenClear(t *testing.T) {
+	m := NewWithCapacity[string, int](10)
+	m.SetMany([]Tuple[string, int]{{Key: "a", Value: 1}, {Key: "b", Value: 2}})
+	if n := m.Len(); n != 2 {
+		t.Fatalf("Len() = %d; want 2", n)
+	}
+	m.Clear()
+	if n := m.Len(); n != 0 {
+		t.Fatalf("Len() = %d after Clear; want 0", n)
+	}
+	if _, ok := m.Get("a"); ok {
+		t.Fatal("Get found a cleared key")
+	}
+	m.Set("c", 3)
+	if n := m.Len(); n != 1 {
+		t.Fatalf("Len() = %d after Clear and Set; want 1", n)
+	}
+}
+
+func TestReaderBiasedWithCapacity(t *testing.T) {
+	m := NewReaderBiasedWithCapacity[string, int](10)
+	if m.bias == nil {
+		t.Fatal("NewReaderBiasedWithCapacity made a map without reader bias")
+	}
+	m.Set("a", 1)
+	if v, ok := m.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get(a) = %d, %v; want 1, true", v, ok)
+	}
+}
+
+// TestReaderBiasExcludesWriters relies on the race detector: a reader in a
+// slot and a writer in the map at the same time is a data race.
+func TestReaderBiasExcludesWriters(t *testing.T) {
+	m := NewReaderBiased[string, int]()
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				k := strconv.Itoa(i % 16)
+				if w == 0 && i%8 == 0 {
+					m.Set(k, i)
+				} else {
+					m.Get(k)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+func TestReaderBiasRevokeAndRearm(t *testing.T) {
+	m := NewReaderBiased[string, int]()
+	rb := m.bias
+	m.Get("a")
+	if !rb.on.Load() {
+		t.Fatal("bias off before any write")
+	}
+	m.Set("a", 1)
+	if rb.on.Load() {
+		t.Fatal("bias still on after a write")
+	}
+	rb.inhibitUntil.Store(time.Now().Add(time.Hour).UnixNano())
+	m.Get("a")
+	if rb.on.Load() {
+		t.Fatal("bias back on while inhibited")
+	}
+	rb.inhibitUntil.Store(0)
+	m.Get("a") // takes the mutex, and rearms
+	if !rb.on.Load() {
+		t.Fatal("bias still off after the inhibition")
+	}
+	if v, _ := m.Get("a"); v != 1 {
+		t.Fatalf("Get(a) = %d; want 1", v)
+	}
+	for i := range rb.slots {
+		if n := rb.slots[i].readers.Load(); n != 0 {
+			t.Fatalf("slot %d has %d readers left", i, n)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package sharded
+
+import (
+	"hash/maphash"
+	"iter"
+	"sync"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+)
+
+// DefaultShards is the shard count used when New is given a non positive one.
+const DefaultShards = 32
+
+// shard is built like rwlock.Map, padded so neighbouring shard locks don't
+// share a cache line.
+type shard[K comparable, V any] struct {
+	mu sync.RWMutex
+	m  map[K]V
+	_  [32]byte
+}
+
+// Map splits the keys across independently locked shards, so writers to
+// different shards don't contend on the same mutex.
+type Map[K comparable, V any] struct {
+	shards []shard[K, V]
+	mask   uint64
+	hash   func(K) uint64
+}
+
+// New returns a Map with n shards (rounded up to a power of two) that places
+// keys with hash. A nil hash uses hash/maphash with a random seed.
+func New[K comparable, V any](n int, hash func(K) uint64) *Map[K, V] {
+	if n <= 0 {
+		n = DefaultShards
+	}
+	size := 1
+	for size < n {
+		size <<= 1
+	}
+	if hash == nil {
+		seed := maphash.MakeSeed()
+		hash = func(key K) uint64 {
+			return maphash.Comparable(seed, key)
+		}
+	}
+
+	ret := &Map[K, V]{
+		shards: make([]shard[K, V], size),
+		mask:   uint64(size - 1),
+		hash:   hash,
+	}
+	for i := range ret.shards {
+		ret.shards[i].m = make(map[K]V)
+	}
+	return ret
+}
+
+func (m *Map[K, V]) shard(key K) *shard[K, V] {
+	return &m.shards[m.hash(key)&m.mask]
+}
+
+// Shards returns the number of shards.
+func (m *Map[K, V]) Shards() int {
+	return len(m.shards)
+}
+
+// Get ...
+func (m *Map[K, V]) Get(key K) (V, bool) {
+	s := m.shard(key)
+	s.mu.RLock()
+	value, ok := s.m[key]
+	s.mu.RUnlock()
+	return value, ok
+}
+
+// Set ...
+func (m *Map[K, V]) Set(key K, value V) {
+	s := m.shard(key)
+	s.mu.Lock()
+	s.m[key] = value
+	s.mu.Unlock()
+}
+
+// Delete ...
+func (m *Map[K, V]) Delete(key K) {
+	s := m.shard(key)
+	s.mu.Lock()
+	delete(s.m, key)
+	s.mu.Unlock()
+}
+
+// Tuple ...
+type Tuple[K comparable, V any] = cmap.Tuple[K, V]
+
+// Iter to use with a range loop
+//
+// Deprecated: use All, it needs neither a goroutine nor a channel buffer the
+// size of the map.
+func (m *Map[K, V]) Iter() <-chan Tuple[K, V] {
+
+	snap := m.Snapshot()
+	// Fully buffered, trade memory for speed baby!
+	ret := make(chan Tuple[K, V], len(snap))
+	go func() {
+		for k, v := range snap {
+			ret <- Tuple[K, V]{Key: k, Value: v}
+		}
+		close(ret)
+	}()
+	return ret
+}
+
+// IterSlice to use with a range loop (with slice snapshot)
+//
+// Deprecated: use All.
+func (m *Map[K, V]) IterSlice() <-chan Tuple[K, V] {
+
+	snap := m.SliceSnapshot()
+	// Fully buffered, trade memory for speed baby!
+	ret := make(chan Tuple[K, V], len(snap))
+	go func() {
+		for _, v := range snap {
+			ret <- v
+		}
+		close(ret)
+	}()
+	return ret
+}
+
+// rlockAll read locks every shard, always in the same order. Writers only ever
+// hold one shard lock, so this can't deadlock with them, and the caller sees a
+// consistent cut across all the shards.
+func (m *Map[K, V]) rlockAll() int {
+	n := 0
+	for i := range m.shards {
+		m.shards[i].mu.RLock()
+		n += len(m.shards[i].m)
+	}
+	return n
+}
+
+func (m *Map[K, V]) runlockAll() {
+	for i := range m.shards {
+		m.shards[i].mu.RUnlock()
+	}
+}
+
+// Snapshot merges all the shards into a single map.
+func (m *Map[K, V]) Snapshot() map[K]V {
+
+	n := m.rlockAll()
+	ret := make(map[K]V, n)
+	for i := range m.shards {
+		for k, v := range m.shards[i].m {
+			ret[k] = v
+		}
+	}
+	m.runlockAll()
+	return ret
+}
+
+// SliceSnapshot merges all the shards into a single slice.
+func (m *Map[K, V]) SliceSnapshot() []Tuple[K, V] {
+	i := 0
+	n := m.rlockAll()
+	ret := make([]Tuple[K, V], n)
+	for s := range m.shards {
+		for k, v := range m.shards[s].m {
+			ret[i] = Tuple[K, V]{Key: k, Value: v}
+			i++
+		}
+	}
+	m.runlockAll()
+	return ret
+}
+
+// Range calls f for every key and value until f returns false, like
+// sync.Map.Range. It walks a snapshot, so f is free to call back into the map.
+func (m *Map[K, V]) Range(f func(key K, value V) bool) {
+	for _, kv := range m.SliceSnapshot() {
+		if !f(kv.Key, kv.Value) {
+			return
+		}
+	}
+}
+
+// All to use with a range-over-func loop. The snapshot is taken when the loop
+// starts, and breaking out early leaves nothing behind.
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	return m.Range
+}
+
+// Keys is like All, but only snapshots and yields the keys.
+func (m *Map[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		keys := make([]K, 0, m.rlockAll())
+		for i := range m.shards {
+			for k := range m.shards[i].m {
+				keys = append(keys, k)
+			}
+		}
+		m.runlockAll()
+		for _, k := range keys {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+// Values is like All, but only snapshots and yields the values.
+func (m *Map[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		values := make([]V, 0, m.rlockAll())
+		for i := range m.shards {
+			for _, v := range m.shards[i].m {
+				values = append(values, v)
+			}
+		}
+		m.runlockAll()
+		for _, v := range values {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package sharded
+
+import (
+	"testing"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+	"github.com/antoniomo/gobench/pkg/cmap/cmaptest"
+)
+
+func TestConformance(t *testing.T) {
+	cmaptest.Run(t, func() cmap.Map[string, string] { return New[string, string](0, nil) })
+}
+
+func TestConformanceSingleShard(t *testing.T) {
+	cmaptest.Run(t, func() cmap.Map[string, string] { return New[string, string](1, nil) })
+}
+
+func TestShardCount(t *testing.T) {
+	for _, tc := range []struct{ n, want int }{
+		{0, DefaultShards},
+		{1, 1},
+		{3, 4},
+		{64, 64},
+	} {
+		if got := New[int, int](tc.n, nil).Shards(); got != tc.want {
+			t.Errorf("New(%d).Shards() = %d; want %d", tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestCustomHash(t *testing.T) {
+	// Everything lands on shard 0, the rest stay empty.
+	m := New[int, int](4, func(int) uint64 { return 0 })
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+	}
+	if n := len(m.shards[0].m); n != 100 {
+		t.Fatalf("shard 0 has %d entries; want 100", n)
+	}
+	if n := len(m.SliceSnapshot()); n != 100 {
+		t.Fatalf("len(SliceSnapshot()) = %d; want 100", n)
+	}
+}
@@ -0,0 +1,375 @@
+// Package skiplist is a concurrent map that keeps its keys in order: a lazy
+// skiplist (Herlihy, Lev, Luchangco and Shavit, "A Simple Optimistic
+// Skiplist Algorithm").
+//
+// Readers never lock. Writers search without locking too, then lock only the
+// few nodes they're about to link or unlink, and check that nothing changed
+// under them, or search again. A node is deleted by marking it first, so
+// readers and other writers can tell a node on its way out, and inserted by
+// linking it bottom up and then flagging it fully linked.
+//
+// On top of Get, Set and Delete, the order makes Range(from, to), Floor,
+// Ceiling and sorted iteration cheap, where the hash maps need a snapshot
+// and a sort.
+package skiplist
+
+import (
+	"cmp"
+	"iter"
+	"math/bits"
+	"math/rand/v2"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+)
+
+// maxLevel is enough for 4^maxLevel entries, with one node in four going up
+// a level.
+const maxLevel = 20
+
+type node[K cmp.Ordered, V any] struct {
+	key         K
+	value       atomic.Pointer[V]
+	next        []atomic.Pointer[node[K, V]] // one per level
+	mu          sync.Mutex                   // held to link or unlink next
+	marked      atomic.Bool                  // deleted, maybe not unlinked yet
+	fullyLinked atomic.Bool                  // inserted on every level
+}
+
+func newNode[K cmp.Ordered, V any](key K, value *V, level int) *node[K, V] {
+	n := &node[K, V]{key: key, next: make([]atomic.Pointer[node[K, V]], level)}
+	n.value.Store(value)
+	return n
+}
+
+// live tells if n is in the map: inserted, and not deleted.
+func (n *node[K, V]) live() bool {
+	return n.fullyLinked.Load() && !n.marked.Load()
+}
+
+// Map ...
+type Map[K cmp.Ordered, V any] struct {
+	head  *node[K, V] // sentinel before every key, nil after the last
+	count atomic.Int64
+}
+
+// New ...
+func New[K cmp.Ordered, V any]() *Map[K, V] {
+	head := newNode[K, V](*new(K), nil, maxLevel)
+	head.fullyLinked.Store(true)
+	return &Map[K, V]{head: head}
+}
+
+// Tuple ...
+type Tuple[K comparable, V any] = cmap.Tuple[K, V]
+
+func randomLevel() int {
+	return min(1+bits.TrailingZeros64(rand.Uint64())/2, maxLevel)
+}
+
+// find fills preds and succs with the nodes around key on every level, and
+// returns the highest level key was found on, or -1.
+func (m *Map[K, V]) find(key K, preds, succs *[maxLevel]*node[K, V]) int {
+	found := -1
+	pred := m.head
+	for level := maxLevel - 1; level >= 0; level-- {
+		curr := pred.next[level].Load()
+		for curr != nil && cmp.Less(curr.key, key) {
+			pred, curr = curr, curr.next[level].Load()
+		}
+		if found == -1 && curr != nil && !cmp.Less(key, curr.key) {
+			found = level
+		}
+		preds[level], succs[level] = pred, curr
+	}
+	return found
+}
+
+// lookup is find for readers: it stops at the first level key is found on.
+func (m *Map[K, V]) lookup(key K) *node[K, V] {
+	pred := m.head
+	for level := maxLevel - 1; level >= 0; level-- {
+		curr := pred.next[level].Load()
+		for curr != nil && cmp.Less(curr.key, key) {
+			pred, curr = curr, curr.next[level].Load()
+		}
+		if curr != nil && !cmp.Less(key, curr.key) {
+			return curr
+		}
+	}
+	return nil
+}
+
+// lockPreds locks the distinct nodes in preds[:levels] and checks that each
+// is still live and still followed by succs on its level. It returns what to
+// hand to unlockPreds, whether or not the check passed.
+func lockPreds[K cmp.Ordered, V any](preds, succs *[maxLevel]*node[K, V], levels int) (int, bool) {
+	var prev *node[K, V]
+	for level := 0; level < levels; level++ {
+		pred, succ := preds[level], succs[level]
+		if pred != prev {
+			pred.mu.Lock()
+			prev = pred
+		}
+		if pred.marked.Load() || pred.next[level].Load() != succ {
+			return level + 1, false
+		}
+	}
+	return levels, true
+}
+
+func unlockPreds[K cmp.Ordered, V any](preds *[maxLevel]*node[K, V], levels int) {
+	var prev *node[K, V]
+	for level := 0; level < levels; level++ {
+		if pred := preds[level]; pred != prev {
+			pred.mu.Unlock()
+			prev = pred
+		}
+	}
+}
+
+// Get ...
+func (m *Map[K, V]) Get(key K) (V, bool) {
+	if n := m.lookup(key); n != nil && n.live() {
+		return *n.value.Load(), true
+	}
+	var zero V
+	return zero, false
+}
+
+// Set ...
+func (m *Map[K, V]) Set(key K, value V) {
+	var preds, succs [maxLevel]*node[K, V]
+	for {
+		if found := m.find(key, &preds, &succs); found != -1 {
+			n := succs[found]
+			if n.marked.Load() {
+				runtime.Gosched() // wait until it's unlinked, and insert anew
+				continue
+			}
+			for !n.fullyLinked.Load() {
+				runtime.Gosched()
+			}
+			// Delete marks under the same lock, so the value isn't lost on a
+			// node that's just been deleted.
+			n.mu.Lock()
+			if !n.marked.Load() {
+				n.value.Store(&value)
+				n.mu.Unlock()
+				return
+			}
+			n.mu.Unlock()
+			continue
+		}
+
+		level := randomLevel()
+		locked, ok := lockPreds(&preds, &succs, level)
+		if !ok {
+			unlockPreds(&preds, locked)
+			continue
+		}
+		n := newNode(key, &value, level)
+		for l := 0; l < level; l++ {
+			n.next[l].Store(succs[l])
+		}
+		for l := 0; l < level; l++ {
+			preds[l].next[l].Store(n)
+		}
+		n.fullyLinked.Store(true)
+		unlockPreds(&preds, locked)
+		m.count.Add(1)
+		return
+	}
+}
+
+// Delete ...
+func (m *Map[K, V]) Delete(key K) {
+	m.LoadAndDelete(key)
+}
+
+// LoadAndDelete deletes key and returns the value it had, if any.
+func (m *Map[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	var (
+		preds, succs [maxLevel]*node[K, V]
+		victim       *node[K, V]
+	)
+	for {
+		found := m.find(key, &preds, &succs)
+		if victim == nil {
+			// Only delete a node found on its top level, as a node still
+			// being linked may not be on every level it should yet.
+			if found == -1 {
+				return value, false
+			}
+			n := succs[found]
+			if !n.fullyLinked.Load() || n.marked.Load() || len(n.next)-1 != found {
+				return value, false
+			}
+			n.mu.Lock()
+			if n.marked.Load() {
+				n.mu.Unlock()
+				return value, false
+			}
+			n.marked.Store(true) // deleted from here on
+			victim = n
+		}
+
+		// victim stays locked until it's unlinked, so nothing links after it.
+		levels := len(victim.next)
+		locked, ok := lockPreds(&preds, &succs, levels)
+		if !ok {
+			unlockPreds(&preds, locked)
+			continue
+		}
+		for l := levels - 1; l >= 0; l-- {
+			preds[l].next[l].Store(victim.next[l].Load())
+		}
+		victim.mu.Unlock()
+		unlockPreds(&preds, locked)
+		m.count.Add(-1)
+		return *victim.value.Load(), true
+	}
+}
+
+// Len is the number of entries. Under concurrent writes it's only a
+// moment's estimate.
+func (m *Map[K, V]) Len() int {
+	return int(m.count.Load())
+}
+
+// Clear deletes every entry, one by one. Entries set while it runs may
+// survive it.
+func (m *Map[K, V]) Clear() {
+	for k := range m.Keys() {
+		m.Delete(k)
+	}
+}
+
+// Floor returns the entry with the greatest key less than or equal to key.
+func (m *Map[K, V]) Floor(key K) (K, V, bool) {
+	return m.before(key, true)
+}
+
+// before returns the last live entry before key, or at key if inclusive.
+// With no back pointers, a dead node found there means searching again for
+// the one before it.
+func (m *Map[K, V]) before(key K, inclusive bool) (K, V, bool) {
+	for {
+		pred := m.head
+		for level := maxLevel - 1; level >= 0; level-- {
+			curr := pred.next[level].Load()
+			for curr != nil && (cmp.Less(curr.key, key) || inclusive && !cmp.Less(key, curr.key)) {
+				pred, curr = curr, curr.next[level].Load()
+			}
+		}
+		if pred == m.head {
+			var (
+				zk K
+				zv V
+			)
+			return zk, zv, false
+		}
+		if pred.live() {
+			return pred.key, *pred.value.Load(), true
+		}
+		key, inclusive = pred.key, false
+	}
+}
+
+// Ceiling returns the entry with the least key greater than or equal to key.
+func (m *Map[K, V]) Ceiling(key K) (K, V, bool) {
+	for n := m.ceiling(key); n != nil; n = n.next[0].Load() {
+		if n.live() {
+			return n.key, *n.value.Load(), true
+		}
+	}
+	var (
+		zk K
+		zv V
+	)
+	return zk, zv, false
+}
+
+// ceiling returns the first node at or after key, live or not.
+func (m *Map[K, V]) ceiling(key K) *node[K, V] {
+	pred := m.head
+	var curr *node[K, V]
+	for level := maxLevel - 1; level >= 0; level-- {
+		curr = pred.next[level].Load()
+		for curr != nil && cmp.Less(curr.key, key) {
+			pred, curr = curr, curr.next[level].Load()
+		}
+	}
+	return curr
+}
+
+// walk yields the live entries in order from n, until stop says so.
+func walk[K cmp.Ordered, V any](n *node[K, V], stop func(K) bool, yield func(K, V) bool) {
+	for ; n != nil && !stop(n.key); n = n.next[0].Load() {
+		if n.live() {
+			if !yield(n.key, *n.value.Load()) {
+				return
+			}
+		}
+	}
+}
+
+// Range to use with a range-over-func loop, yields the entries with keys in
+// [from, to), in order. Like lockfree.Map.Range, it sees every entry present
+// for the whole walk once, and may or may not see the ones written during
+// it. The loop is free to write to the map.
+func (m *Map[K, V]) Range(from, to K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		walk(m.ceiling(from), func(k K) bool { return !cmp.Less(k, to) }, yield)
+	}
+}
+
+// All yields every entry in key order, with the guarantees of Range.
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		walk(m.head.next[0].Load(), func(K) bool { return false }, yield)
+	}
+}
+
+// Keys is like All, but only yields the keys.
+func (m *Map[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for k := range m.All() {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+// Values is like All, but only yields the values.
+func (m *Map[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, v := range m.All() {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// Snapshot copies the map with All, so it isn't a point in time view under
+// concurrent writes.
+func (m *Map[K, V]) Snapshot() map[K]V {
+	ret := make(map[K]V, max(m.Len(), 0))
+	for k, v := range m.All() {
+		ret[k] = v
+	}
+	return ret
+}
+
+// SliceSnapshot is Snapshot as a slice, sorted by key.
+func (m *Map[K, V]) SliceSnapshot() []Tuple[K, V] {
+	ret := make([]Tuple[K, V], 0, max(m.Len(), 0))
+	for k, v := range m.All() {
+		ret = append(ret, Tuple[K, V]{Key: k, Value: v})
+	}
+	return ret
+}
@@ -0,0 +1,155 @@
+package skiplist
+
+import (
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+	"github.com/antoniomo/gobench/pkg/cmap/cmaptest"
+)
+
+func TestConformance(t *testing.T) {
+	cmaptest.Run(t, func() cmap.Map[string, string] { return New[string, string]() })
+}
+
+// TestOrdered checks Range, Floor, Ceiling and All against a sorted slice of
+// the same keys.
+func TestOrdered(t *testing.T) {
+	m := New[int, int]()
+	var keys []int
+	for i := 0; i < 500; i++ {
+		k := rand.IntN(2000)
+		if _, ok := m.Get(k); !ok {
+			keys = append(keys, k)
+		}
+		m.Set(k, -k)
+	}
+	for _, k := range keys[:100] {
+		m.Delete(k)
+	}
+	keys = keys[100:]
+	slices.Sort(keys)
+
+	var got []int
+	for k, v := range m.All() {
+		if v != -k {
+			t.Fatalf("All yielded %d: %d; want %d", k, v, -k)
+		}
+		got = append(got, k)
+	}
+	if !slices.Equal(got, keys) {
+		t.Fatalf("All yielded %v; want %v", got, keys)
+	}
+	if m.Len() != len(keys) {
+		t.Fatalf("Len() = %d; want %d", m.Len(), len(keys))
+	}
+
+	for q := -1; q <= 2001; q++ {
+		i, found := slices.BinarySearch(keys, q)
+
+		k, v, ok := m.Ceiling(q)
+		if want := i < len(keys); ok != want || ok && (k != keys[i] || v != -k) {
+			t.Fatalf("Ceiling(%d) = %d, %d, %v", q, k, v, ok)
+		}
+
+		if !found {
+			i--
+		}
+		k, v, ok = m.Floor(q)
+		if want := i >= 0; ok != want || ok && (k != keys[i] || v != -k) {
+			t.Fatalf("Floor(%d) = %d, %d, %v", q, k, v, ok)
+		}
+	}
+
+	for _, r := range [][2]int{{0, 2000}, {100, 200}, {500, 500}, {300, 100}, {-5, 3000}} {
+		var got, want []int
+		for k := range m.Range(r[0], r[1]) {
+			got = append(got, k)
+		}
+		for _, k := range keys {
+			if k >= r[0] && k < r[1] {
+				want = append(want, k)
+			}
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("Range(%d, %d) yielded %v; want %v", r[0], r[1], got, want)
+		}
+	}
+}
+
+// TestFloorSkipsDeleted has Floor land on a deleted node still in the list.
+func TestFloorSkipsDeleted(t *testing.T) {
+	m := New[int, int]()
+	m.Set(1, 1)
+	m.Set(2, 2)
+	var preds, succs [maxLevel]*node[int, int]
+	m.find(2, &preds, &succs)
+	succs[0].marked.Store(true) // deleted, as if its deleter hadn't unlinked it yet
+
+	if k, _, ok := m.Floor(5); !ok || k != 1 {
+		t.Fatalf("Floor(5) = %d, %v; want 1, true", k, ok)
+	}
+	if _, _, ok := m.Ceiling(2); ok {
+		t.Fatal("Ceiling(2) found the deleted key")
+	}
+}
+
+// TestConcurrentWriters has writers set and delete overlapping keys, then
+// checks the list is still sorted, without duplicates, on every level.
+func TestConcurrentWriters(t *testing.T) {
+	const workers = 8
+	m := New[int, int]()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 5000; i++ {
+				k := rand.IntN(1000)
+				if i%3 == w%3 {
+					m.Delete(k)
+				} else {
+					m.Set(k, w)
+				}
+				m.Floor(k)
+				for range m.Range(k, k+10) {
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for level := 0; level < maxLevel; level++ {
+		for n := m.head.next[level].Load(); n != nil; n = n.next[level].Load() {
+			if n.marked.Load() {
+				t.Fatalf("deleted key %d still linked on level %d", n.key, level)
+			}
+			if next := n.next[level].Load(); next != nil && next.key <= n.key {
+				t.Fatalf("level %d has %d before %d", level, n.key, next.key)
+			}
+		}
+	}
+	n := 0
+	for range m.All() {
+		n++
+	}
+	if n != m.Len() {
+		t.Fatalf("%d entries in the list, Len() = %d", n, m.Len())
+	}
+}
+
+func TestClear(t *testing.T) {
+	m := New[int, int]()
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+	}
+	m.Clear()
+	if n := m.Len(); n != 0 {
+		t.Fatalf("Len() = %d after Clear; want 0", n)
+	}
+	for range m.All() {
+		t.Fatal("All yielded an entry after Clear")
+	}
+}
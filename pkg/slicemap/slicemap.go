@@ -1,6 +1,9 @@
 package slicemap
 
-import "sort"
+import (
+	"slices"
+	"sort"
+)
 
 // After seen the talk at https://www.youtube.com/watch?v=jEG4Qyo_4Bc I wanted
 // to check the performance of map-type interface built over a slice, for small
@@ -99,3 +102,37 @@ func (bs *BinarySlicemap) Delete(k string) {
 		*bs = append(s[:idx], s[idx+1:]...)
 	}
 }
+
+// Len ...
+func (sm *LinearSlicemap) Len() int {
+	return len(*sm)
+}
+
+// Clear empties the map, keeping its capacity.
+func (sm *LinearSlicemap) Clear() {
+	s := *sm
+	clear(s) // let go of the strings
+	*sm = s[:0]
+}
+
+// Reserve makes room for n more entries without reallocating.
+func (sm *LinearSlicemap) Reserve(n int) {
+	*sm = slices.Grow(*sm, n)
+}
+
+// Len ...
+func (bs *BinarySlicemap) Len() int {
+	return len(*bs)
+}
+
+// Clear empties the map, keeping its capacity.
+func (bs *BinarySlicemap) Clear() {
+	s := *bs
+	clear(s) // let go of the strings
+	*bs = s[:0]
+}
+
+// Reserve makes room for n more entries without reallocating.
+func (bs *BinarySlicemap) Reserve(n int) {
+	*bs = slices.Grow(*bs, n)
+}
@@ -0,0 +1,94 @@
+package slicemap
+
+import (
+	"strconv"
+	"testing"
+)
+
+type slicemap interface {
+	Set(k, val string)
+	Get(k string) (string, bool)
+	Delete(k string)
+	Len() int
+	Clear()
+	Reserve(n int)
+}
+
+var impls = map[string]func() (slicemap, func() []Tuple){
+	"linear": func() (slicemap, func() []Tuple) {
+		var sm LinearSlicemap
+		return &sm, func() []Tuple { return sm }
+	},
+	"binary": func() (slicemap, func() []Tuple) {
+		var bs BinarySlicemap
+		return &bs, func() []Tuple { return bs }
+	},
+}
+
+func TestLen(t *testing.T) {
+	for name, newMap := range impls {
+		t.Run(name, func(t *testing.T) {
+			m, _ := newMap()
+			for i := 0; i < 10; i++ {
+				m.Set(strconv.Itoa(i), "v")
+				m.Set(strconv.Itoa(i), "w") // overwrites don't count
+			}
+			if n := m.Len(); n != 10 {
+				t.Fatalf("Len() = %d after 10 sets; want 10", n)
+			}
+			for i := 0; i < 10; i += 2 {
+				m.Delete(strconv.Itoa(i))
+			}
+			m.Delete("missing")
+			if n := m.Len(); n != 5 {
+				t.Fatalf("Len() = %d after 5 deletes; want 5", n)
+			}
+		})
+	}
+}
+
+func TestClear(t *testing.T) {
+	for name, newMap := range impls {
+		t.Run(name, func(t *testing.T) {
+			m, slice := newMap()
+			for i := 0; i < 10; i++ {
+				m.Set(strconv.Itoa(i), "v")
+			}
+			c := cap(slice())
+			m.Clear()
+			if n := m.Len(); n != 0 {
+				t.Fatalf("Len() = %d after Clear; want 0", n)
+			}
+			if cap(slice()) != c {
+				t.Fatalf("capacity %d after Clear; want %d", cap(slice()), c)
+			}
+			if _, ok := m.Get("1"); ok {
+				t.Fatal("Get(1) found a key after Clear")
+			}
+
+			m.Set("a", "1")
+			m.Set("b", "2")
+			m.Delete("a")
+			if v, ok := m.Get("b"); !ok || v != "2" || m.Len() != 1 {
+				t.Fatalf("Get(b) = %q, %v, Len() = %d after Clear and reuse", v, ok, m.Len())
+			}
+		})
+	}
+}
+
+func TestReserve(t *testing.T) {
+	for name, newMap := range impls {
+		t.Run(name, func(t *testing.T) {
+			m, slice := newMap()
+			m.Set("first", "v")
+			m.Reserve(100)
+			before := &slice()[0]
+			for i := 0; i < 100; i++ {
+				m.Set(strconv.Itoa(i), "v")
+			}
+			if &slice()[0] != before {
+				t.Fatal("100 sets reallocated after Reserve(100)")
+			}
+		})
+	}
+}
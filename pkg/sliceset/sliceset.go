@@ -1,6 +1,7 @@
 package sliceset
 
 import (
+	"slices"
 	"sort"
 )
 
@@ -107,7 +108,7 @@ type HybridSet struct {
 // NewHybridSet ...
 func NewHybridSet(hintSize int) *HybridSet {
 	ret := &HybridSet{
-		Set: make(map[string]int),
+		Set: make(map[string]int, hintSize),
 	}
 	if hintSize != 0 {
 		ret.Slice = make([]string, 0, hintSize)
@@ -140,7 +141,7 @@ func (hs *HybridSet) Delete(val string) {
 	delete(hs.Set, val)
 	// Sad, sad...
 	for i, v := range hs.Slice[idx+1 : len(hs.Slice)] {
-		hs.Set[v] = i
+		hs.Set[v] = idx + i
 	}
 	hs.Slice = append(hs.Slice[:idx], hs.Slice[idx+1:]...)
 }
@@ -149,3 +150,55 @@ func (hs *HybridSet) Delete(val string) {
 func (hs *HybridSet) Snapshot() []string {
 	return append(hs.Slice[:0:0], hs.Slice...)
 }
+
+// Len ...
+func (ss *LinearSliceset) Len() int {
+	return len(*ss)
+}
+
+// Clear empties the set, keeping its capacity.
+func (ss *LinearSliceset) Clear() {
+	s := *ss
+	clear(s) // let go of the strings
+	*ss = s[:0]
+}
+
+// Reserve makes room for n more members without reallocating.
+func (ss *LinearSliceset) Reserve(n int) {
+	*ss = slices.Grow(*ss, n)
+}
+
+// Len ...
+func (bs *BinarySliceset) Len() int {
+	return len(*bs)
+}
+
+// Clear empties the set, keeping its capacity.
+func (bs *BinarySliceset) Clear() {
+	s := *bs
+	clear(s) // let go of the strings
+	*bs = s[:0]
+}
+
+// Reserve makes room for n more members without reallocating.
+func (bs *BinarySliceset) Reserve(n int) {
+	*bs = slices.Grow(*bs, n)
+}
+
+// Len ...
+func (hs *HybridSet) Len() int {
+	return len(hs.Slice)
+}
+
+// Clear empties the set, keeping the capacity of both the slice and the map.
+func (hs *HybridSet) Clear() {
+	clear(hs.Slice) // let go of the strings
+	hs.Slice = hs.Slice[:0]
+	clear(hs.Set)
+}
+
+// Reserve makes room for n more members in the slice without reallocating.
+// The map can't be grown in place, only NewHybridSet can size it.
+func (hs *HybridSet) Reserve(n int) {
+	hs.Slice = slices.Grow(hs.Slice, n)
+}
@@ -0,0 +1,113 @@
+package sliceset
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+)
+
+type sliceset interface {
+	Insert(val string)
+	IsMember(val string) bool
+	Delete(val string)
+	Snapshot() []string
+	Len() int
+	Clear()
+	Reserve(n int)
+}
+
+var impls = map[string]func() (sliceset, func() []string){
+	"linear": func() (sliceset, func() []string) {
+		var ss LinearSliceset
+		return &ss, func() []string { return ss }
+	},
+	"binary": func() (sliceset, func() []string) {
+		var bs BinarySliceset
+		return &bs, func() []string { return bs }
+	},
+	"hybrid": func() (sliceset, func() []string) {
+		hs := NewHybridSet(0)
+		return hs, func() []string { return hs.Slice }
+	},
+}
+
+func TestLen(t *testing.T) {
+	for name, newSet := range impls {
+		t.Run(name, func(t *testing.T) {
+			s, _ := newSet()
+			for i := 0; i < 10; i++ {
+				s.Insert(strconv.Itoa(i))
+				s.Insert(strconv.Itoa(i)) // already a member
+			}
+			if n := s.Len(); n != 10 {
+				t.Fatalf("Len() = %d after 10 inserts; want 10", n)
+			}
+			for i := 0; i < 10; i += 2 {
+				s.Delete(strconv.Itoa(i))
+			}
+			s.Delete("missing")
+			if n := s.Len(); n != 5 {
+				t.Fatalf("Len() = %d after 5 deletes; want 5", n)
+			}
+
+			got := s.Snapshot()
+			slices.Sort(got)
+			if want := []string{"1", "3", "5", "7", "9"}; !slices.Equal(got, want) {
+				t.Fatalf("Snapshot() = %v; want %v", got, want)
+			}
+			for i := 0; i < 10; i++ {
+				if s.IsMember(strconv.Itoa(i)) != (i%2 == 1) {
+					t.Fatalf("IsMember(%d) = %v", i, !(i%2 == 1))
+				}
+			}
+		})
+	}
+}
+
+func TestClear(t *testing.T) {
+	for name, newSet := range impls {
+		t.Run(name, func(t *testing.T) {
+			s, slice := newSet()
+			for i := 0; i < 10; i++ {
+				s.Insert(strconv.Itoa(i))
+			}
+			c := cap(slice())
+			s.Clear()
+			if n := s.Len(); n != 0 {
+				t.Fatalf("Len() = %d after Clear; want 0", n)
+			}
+			if cap(slice()) != c {
+				t.Fatalf("capacity %d after Clear; want %d", cap(slice()), c)
+			}
+			if s.IsMember("1") {
+				t.Fatal("IsMember(1) after Clear")
+			}
+
+			s.Insert("a")
+			s.Insert("b")
+			s.Insert("c")
+			s.Delete("a")
+			s.Delete("b")
+			if !s.IsMember("c") || s.Len() != 1 {
+				t.Fatalf("IsMember(c) = %v, Len() = %d after Clear and reuse", s.IsMember("c"), s.Len())
+			}
+		})
+	}
+}
+
+func TestReserve(t *testing.T) {
+	for name, newSet := range impls {
+		t.Run(name, func(t *testing.T) {
+			s, slice := newSet()
+			s.Insert("first")
+			s.Reserve(100)
+			before := &slice()[0]
+			for i := 0; i < 100; i++ {
+				s.Insert(strconv.Itoa(i))
+			}
+			if &slice()[0] != before {
+				t.Fatal("100 inserts reallocated after Reserve(100)")
+			}
+		})
+	}
+}
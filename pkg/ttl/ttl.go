@@ -0,0 +1,253 @@
+// Package ttl is a map built like rwlock.Map whose entries expire. Expired
+// entries are never returned, and are removed lazily by Get, and in bulk by an
+// optional janitor goroutine.
+package ttl
+
+import (
+	"iter"
+	"sync"
+	"time"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+)
+
+// Clock tells the time. Tests inject their own to make expiry deterministic.
+type Clock interface {
+	Now() time.Time
+}
+
+// Ticker is a Clock that can also drive the janitor. The janitor of a Map
+// whose Clock isn't a Ticker runs on real time, even though expiry doesn't.
+type Ticker interface {
+	Clock
+	// Tick is time.NewTicker: it returns the channel ticks are sent on every
+	// d, and a func to stop them.
+	Tick(d time.Duration) (c <-chan time.Time, stop func())
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) Tick(d time.Duration) (<-chan time.Time, func()) {
+	t := time.NewTicker(d)
+	return t.C, t.Stop
+}
+
+type item[V any] struct {
+	value   V
+	expires int64 // UnixNano, 0 for never
+}
+
+func (it item[V]) expired(now int64) bool {
+	return it.expires != 0 && now >= it.expires
+}
+
+// Map ...
+type Map[K comparable, V any] struct {
+	mu    sync.RWMutex
+	m     map[K]item[V]
+	ttl   time.Duration
+	clock Clock
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// New returns a Map whose Set entries live for defaultTTL, or forever if it's
+// zero. If interval isn't zero, a janitor goroutine removes expired entries
+// that often, until Close.
+func New[K comparable, V any](defaultTTL, interval time.Duration) *Map[K, V] {
+	return NewWithClock[K, V](defaultTTL, interval, realClock{})
+}
+
+// NewWithClock is New with a custom Clock. The janitor ticks on clock if it's
+// a Ticker, and on real time otherwise.
+func NewWithClock[K comparable, V any](defaultTTL, interval time.Duration, clock Clock) *Map[K, V] {
+	ret := &Map[K, V]{
+		m:     make(map[K]item[V]),
+		ttl:   defaultTTL,
+		clock: clock,
+		done:  make(chan struct{}),
+	}
+	if interval > 0 {
+		ret.wg.Add(1)
+		go ret.janitor(interval)
+	}
+	return ret
+}
+
+func (m *Map[K, V]) janitor(interval time.Duration) {
+	defer m.wg.Done()
+	var tick <-chan time.Time
+	if t, ok := m.clock.(Ticker); ok {
+		c, stop := t.Tick(interval)
+		defer stop()
+		tick = c
+	} else {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		select {
+		case <-tick:
+			m.DeleteExpired()
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// Close stops the janitor, if any. The Map is still usable afterwards, it just
+// falls back to lazy expiry.
+func (m *Map[K, V]) Close() {
+	m.closeOnce.Do(func() { close(m.done) })
+	m.wg.Wait()
+}
+
+func (m *Map[K, V]) now() int64 {
+	return m.clock.Now().UnixNano()
+}
+
+// Get ...
+func (m *Map[K, V]) Get(key K) (V, bool) {
+	now := m.now()
+	m.mu.RLock()
+	it, ok := m.m[key]
+	m.mu.RUnlock()
+	if ok && it.expired(now) {
+		m.mu.Lock()
+		// Someone may have Set it again while we weren't holding the lock.
+		if it, ok := m.m[key]; ok && it.expired(now) {
+			delete(m.m, key)
+		}
+		m.mu.Unlock()
+		ok = false
+	}
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return it.value, true
+}
+
+// Set stores value with the default TTL.
+func (m *Map[K, V]) Set(key K, value V) {
+	m.SetWithTTL(key, value, m.ttl)
+}
+
+// SetWithTTL stores value for ttl, or forever if ttl isn't positive.
+func (m *Map[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	it := item[V]{value: value}
+	if ttl > 0 {
+		it.expires = m.now() + int64(ttl)
+	}
+	m.mu.Lock()
+	m.m[key] = it
+	m.mu.Unlock()
+}
+
+// Delete ...
+func (m *Map[K, V]) Delete(key K) {
+	m.mu.Lock()
+	delete(m.m, key)
+	m.mu.Unlock()
+}
+
+// DeleteExpired removes all the expired entries. The janitor calls it every
+// interval.
+func (m *Map[K, V]) DeleteExpired() {
+	now := m.now()
+	m.mu.Lock()
+	for k, it := range m.m {
+		if it.expired(now) {
+			delete(m.m, k)
+		}
+	}
+	m.mu.Unlock()
+}
+
+// Tuple ...
+type Tuple[K comparable, V any] = cmap.Tuple[K, V]
+
+// Snapshot has the entries that are live at the time it's taken.
+func (m *Map[K, V]) Snapshot() map[K]V {
+
+	now := m.now()
+	ret := make(map[K]V)
+	m.mu.RLock()
+	for k, it := range m.m {
+		if !it.expired(now) {
+			ret[k] = it.value
+		}
+	}
+	m.mu.RUnlock()
+	return ret
+}
+
+// SliceSnapshot has the entries that are live at the time it's taken.
+func (m *Map[K, V]) SliceSnapshot() []Tuple[K, V] {
+	now := m.now()
+	m.mu.RLock()
+	ret := make([]Tuple[K, V], 0, len(m.m))
+	for k, it := range m.m {
+		if !it.expired(now) {
+			ret = append(ret, Tuple[K, V]{Key: k, Value: it.value})
+		}
+	}
+	m.mu.RUnlock()
+	return ret
+}
+
+// Iter to use with a range loop
+//
+// Deprecated: use All, it needs neither a goroutine nor a channel buffer the
+// size of the map.
+func (m *Map[K, V]) Iter() <-chan Tuple[K, V] {
+
+	snap := m.Snapshot()
+	// Fully buffered, trade memory for speed baby!
+	ret := make(chan Tuple[K, V], len(snap))
+	go func() {
+		for k, v := range snap {
+			ret <- Tuple[K, V]{Key: k, Value: v}
+		}
+		close(ret)
+	}()
+	return ret
+}
+
+// IterSlice to use with a range loop (with slice snapshot)
+//
+// Deprecated: use All.
+func (m *Map[K, V]) IterSlice() <-chan Tuple[K, V] {
+
+	snap := m.SliceSnapshot()
+	// Fully buffered, trade memory for speed baby!
+	ret := make(chan Tuple[K, V], len(snap))
+	go func() {
+		for _, v := range snap {
+			ret <- v
+		}
+		close(ret)
+	}()
+	return ret
+}
+
+// Range calls f for every live key and value until f returns false, like
+// sync.Map.Range. It walks a snapshot, so f is free to call back into the map.
+func (m *Map[K, V]) Range(f func(key K, value V) bool) {
+	for _, kv := range m.SliceSnapshot() {
+		if !f(kv.Key, kv.Value) {
+			return
+		}
+	}
+}
+
+// All to use with a range-over-func loop. The snapshot is taken when the loop
+// starts, and breaking out early leaves nothing behind.
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	return m.Range
+}
@@ -0,0 +1,153 @@
+package ttl
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+	"github.com/antoniomo/gobench/pkg/cmap/cmaptest"
+)
+
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	ticks chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func (c *fakeClock) Tick(time.Duration) (<-chan time.Time, func()) {
+	return c.ticks, func() {}
+}
+
+func newFake(defaultTTL time.Duration) (*Map[string, string], *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	return NewWithClock[string, string](defaultTTL, 0, clock), clock
+}
+
+func TestConformance(t *testing.T) {
+	cmaptest.Run(t, func() cmap.Map[string, string] { return New[string, string](time.Hour, 0) })
+}
+
+func TestLazyExpiry(t *testing.T) {
+	m, clock := newFake(time.Minute)
+	m.Set("default", "v")
+	m.SetWithTTL("short", "v", time.Second)
+	m.SetWithTTL("forever", "v", 0)
+
+	clock.Advance(time.Second - 1)
+	if _, ok := m.Get("short"); !ok {
+		t.Fatal("entry expired early")
+	}
+	clock.Advance(1)
+	if _, ok := m.Get("short"); ok {
+		t.Fatal("Get returned an expired entry")
+	}
+	if _, ok := m.m["short"]; ok {
+		t.Fatal("Get didn't remove the expired entry")
+	}
+
+	clock.Advance(time.Hour)
+	if _, ok := m.Get("default"); ok {
+		t.Fatal("default TTL not applied")
+	}
+	if _, ok := m.Get("forever"); !ok {
+		t.Fatal("entry without TTL expired")
+	}
+}
+
+func TestSetRenewsTTL(t *testing.T) {
+	m, clock := newFake(time.Minute)
+	m.Set("k", "1")
+	clock.Advance(50 * time.Second)
+	m.Set("k", "2")
+	clock.Advance(50 * time.Second)
+	if v, ok := m.Get("k"); !ok || v != "2" {
+		t.Fatalf("Get(k) = %q, %v; want \"2\", true", v, ok)
+	}
+}
+
+func TestSnapshotsSkipExpired(t *testing.T) {
+	m, clock := newFake(0)
+	m.SetWithTTL("expired", "v", time.Second)
+	m.SetWithTTL("live", "v", time.Hour)
+	clock.Advance(time.Minute)
+
+	if snap := m.Snapshot(); len(snap) != 1 || snap["live"] != "v" {
+		t.Fatalf("Snapshot() = %v; want map[live:v]", snap)
+	}
+	if snap := m.SliceSnapshot(); len(snap) != 1 || snap[0].Key != "live" {
+		t.Fatalf("SliceSnapshot() = %v; want [{live v}]", snap)
+	}
+	for k := range m.All() {
+		if k != "live" {
+			t.Fatalf("All yielded expired key %q", k)
+		}
+	}
+	for kv := range m.Iter() {
+		if kv.Key != "live" {
+			t.Fatalf("Iter yielded expired key %q", kv.Key)
+		}
+	}
+}
+
+func TestDeleteExpired(t *testing.T) {
+	m, clock := newFake(time.Second)
+	m.Set("a", "v")
+	m.SetWithTTL("b", "v", time.Hour)
+	clock.Advance(time.Minute)
+	m.DeleteExpired()
+	if len(m.m) != 1 {
+		t.Fatalf("%d entries left after DeleteExpired; want 1", len(m.m))
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	m := New[string, string](time.Nanosecond, time.Millisecond)
+	defer m.Close()
+	m.Set("k", "v")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		m.mu.RLock()
+		n := len(m.m)
+		m.mu.RUnlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("janitor didn't remove the expired entry")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	m.Close() // twice is fine
+}
+
+func TestJanitorOnClock(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0), ticks: make(chan time.Time)}
+	m := NewWithClock[string, string](time.Minute, time.Hour, clock)
+	defer m.Close()
+	m.Set("k", "v")
+	clock.Advance(2 * time.Minute)
+
+	// The channel is unbuffered: the second tick is only taken once the
+	// janitor is done with the first.
+	clock.ticks <- clock.Now()
+	clock.ticks <- clock.Now()
+	m.mu.RLock()
+	n := len(m.m)
+	m.mu.RUnlock()
+	if n != 0 {
+		t.Fatalf("%d entries left after a tick; want 0", n)
+	}
+}
@@ -0,0 +1,475 @@
+// Package wal adds a write-ahead log to lock.Map and rwlock.Map, so they
+// survive crashes and restarts.
+//
+// A WAL directory holds two files: "snapshot", a pkg/codec snapshot written
+// with codec.SaveFile, and "log", every Set and Delete since that snapshot.
+// Open loads the snapshot and replays the log on top. Once the log grows past
+// Options.CompactSize, the map is snapshotted and the log emptied.
+//
+// Each log record is
+//
+//	little endian uint32 payload length | little endian uint32 CRC-32C of the payload
+//	payload: op byte | key | value (sets only)
+//
+// with keys and values encoded by codec.AppendEntry.
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/antoniomo/gobench/pkg/cmap"
+	"github.com/antoniomo/gobench/pkg/codec"
+)
+
+// Backend is the map a WAL writes through to. lock.Map and rwlock.Map are
+// Backends.
+type Backend[K comparable, V any] interface {
+	cmap.Map[K, V]
+	io.WriterTo
+	io.ReaderFrom
+}
+
+// SyncPolicy says when appended records are fsynced.
+type SyncPolicy int
+
+const (
+	// SyncAlways fsyncs every record before Set or Delete return. Nothing
+	// acknowledged is ever lost, but every write waits for the disk.
+	SyncAlways SyncPolicy = iota
+	// SyncInterval fsyncs in the background every Options.Interval. A power
+	// loss can lose up to an Interval of writes, a process crash can't.
+	SyncInterval
+	// SyncNever leaves it to the OS, and to Close.
+	SyncNever
+)
+
+func (p SyncPolicy) String() string {
+	switch p {
+	case SyncAlways:
+		return "always"
+	case SyncInterval:
+		return "interval"
+	case SyncNever:
+		return "never"
+	}
+	return "SyncPolicy(?)"
+}
+
+// Options ...
+type Options struct {
+	Sync SyncPolicy
+	// Interval between fsyncs for SyncInterval. Defaults to DefaultInterval.
+	Interval time.Duration
+	// CompactSize is the log size, in bytes, that triggers a compaction.
+	// Defaults to DefaultCompactSize, negative disables compaction.
+	CompactSize int64
+}
+
+// Defaults for Options.
+const (
+	DefaultInterval    = 100 * time.Millisecond
+	DefaultCompactSize = 64 << 20
+)
+
+// File names within the WAL directory.
+const (
+	SnapshotFile = "snapshot"
+	LogFile      = "log"
+)
+
+const (
+	opSet byte = iota + 1
+	opDelete
+)
+
+const (
+	headerLen    = 8
+	maxRecordLen = 1 << 30
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// ErrClosed is returned by writes after Close.
+	ErrClosed = errors.New("wal: closed")
+	// ErrCorrupt is returned by Open for a log with a bad record that isn't
+	// its torn tail.
+	ErrCorrupt = errors.New("wal: corrupt log")
+)
+
+// Map is a Backend with every write logged first. Reads go straight to the
+// Backend, writes are serialized so that the log has them in the order they
+// were applied.
+type Map[K comparable, V any] struct {
+	m    Backend[K, V]
+	dir  string
+	opts Options
+
+	mu    sync.Mutex // guards everything below, and orders writes
+	f     *os.File
+	size  int64
+	dirty bool  // written since the last fsync
+	err   error // sticky, a failed append or fsync poisons the log
+	buf   []byte
+
+	// compactErr is the error of the last compaction, if it failed, and
+	// nextCompact the log size at which maybeCompact tries again.
+	compactErr  error
+	nextCompact int64
+
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// Open recovers m from dir, creating dir if needed, and logs every write made
+// through the returned Map from then on. m should be empty, and must only be
+// written to through the returned Map.
+//
+// A torn or corrupt record with no good record after it ends the replay, and
+// is cut from the log: that's what a crash halfway through an append leaves
+// behind. A bad record with good ones after it can't be a crash, and cutting
+// it would lose them: Open fails with ErrCorrupt instead, leaving the log as
+// it is.
+func Open[K comparable, V any](dir string, m Backend[K, V], opts Options) (*Map[K, V], error) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.CompactSize == 0 {
+		opts.CompactSize = DefaultCompactSize
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	err := codec.LoadFile(filepath.Join(dir, SnapshotFile), m)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("wal: loading snapshot: %w", err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, LogFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	size, err := replay(f, m)
+	if err == nil {
+		err = f.Truncate(size) // drop a torn tail, if any
+	}
+	if err == nil {
+		_, err = f.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("wal: replaying log: %w", err)
+	}
+
+	w := &Map[K, V]{m: m, dir: dir, opts: opts, f: f, size: size, nextCompact: opts.CompactSize, done: make(chan struct{})}
+	if opts.Sync == SyncInterval {
+		w.wg.Add(1)
+		go w.syncer()
+	}
+	return w, nil
+}
+
+// replay applies the records in f to m, and returns the size of the log up
+// to the last good one.
+func replay[K comparable, V any](f *os.File, m Backend[K, V]) (int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	end := fi.Size()
+	r := bufio.NewReader(f)
+	var (
+		size int64
+		hdr  [headerLen]byte
+		p    []byte
+	)
+	for size < end {
+		if end-size < headerLen {
+			return size, tornTail(f, size, end)
+		}
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return size, err
+		}
+		n := binary.LittleEndian.Uint32(hdr[:4])
+		if n == 0 || n > maxRecordLen || int64(n) > end-size-headerLen {
+			return size, tornTail(f, size, end)
+		}
+		if cap(p) < int(n) {
+			p = make([]byte, n)
+		}
+		p = p[:n]
+		if _, err := io.ReadFull(r, p); err != nil {
+			return size, err
+		}
+		if crc32.Checksum(p, castagnoli) != binary.LittleEndian.Uint32(hdr[4:]) || !apply(m, p) {
+			return size, tornTail(f, size, end)
+		}
+		size += headerLen + int64(n)
+	}
+	return size, nil
+}
+
+// tornTail is called for a bad record at off. It returns nil if no good
+// record starts anywhere after it, so that it's the torn tail a crash leaves,
+// and ErrCorrupt otherwise.
+func tornTail(f *os.File, off, end int64) error {
+	b := make([]byte, end-off)
+	if _, err := f.ReadAt(b, off); err != nil {
+		return err
+	}
+	for i := 1; i+headerLen < len(b); i++ {
+		if intact(b[i:]) {
+			return fmt.Errorf("%w: bad record at offset %d, good one at %d", ErrCorrupt, off, off+int64(i))
+		}
+	}
+	return nil
+}
+
+// intact reports whether b starts with a whole record with a good checksum.
+func intact(b []byte) bool {
+	n := binary.LittleEndian.Uint32(b[:4])
+	if n == 0 || n > maxRecordLen || int64(n) > int64(len(b)-headerLen) {
+		return false
+	}
+	p := b[headerLen : headerLen+n]
+	return crc32.Checksum(p, castagnoli) == binary.LittleEndian.Uint32(b[4:headerLen]) &&
+		(p[0] == opSet || p[0] == opDelete)
+}
+
+// apply applies a record's payload to m, and reports whether it made sense.
+func apply[K comparable, V any](m Backend[K, V], p []byte) bool {
+	switch p[0] {
+	case opSet:
+		k, v, err := codec.DecodeEntry[K, V](p[1:])
+		if err != nil {
+			return false
+		}
+		m.Set(k, v)
+	case opDelete:
+		k, err := codec.DecodeKey[K](p[1:])
+		if err != nil {
+			return false
+		}
+		m.Delete(k)
+	default:
+		return false
+	}
+	return true
+}
+
+// Get ...
+func (w *Map[K, V]) Get(key K) (V, bool) {
+	return w.m.Get(key)
+}
+
+// Set logs the write, then applies it. Once it returns without error, the
+// write survives a crash, subject to the SyncPolicy.
+func (w *Map[K, V]) Set(key K, value V) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	b, err := codec.AppendEntry(w.record(opSet), key, value)
+	if err != nil {
+		return err
+	}
+	if err := w.append(b); err != nil {
+		return err
+	}
+	w.m.Set(key, value)
+	w.maybeCompact()
+	return nil
+}
+
+// Delete is like Set.
+func (w *Map[K, V]) Delete(key K) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	b, err := codec.AppendKey(w.record(opDelete), key)
+	if err != nil {
+		return err
+	}
+	if err := w.append(b); err != nil {
+		return err
+	}
+	w.m.Delete(key)
+	w.maybeCompact()
+	return nil
+}
+
+// Snapshot ...
+func (w *Map[K, V]) Snapshot() map[K]V {
+	return w.m.Snapshot()
+}
+
+// All ...
+func (w *Map[K, V]) All() iter.Seq2[K, V] {
+	return w.m.All()
+}
+
+// record starts a record in buf, leaving room for the header.
+func (w *Map[K, V]) record(op byte) []byte {
+	w.buf = append(w.buf[:0], make([]byte, headerLen)...)
+	return append(w.buf, op)
+}
+
+// append fills in the header of b and appends it to the log.
+func (w *Map[K, V]) append(b []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	p := b[headerLen:]
+	binary.LittleEndian.PutUint32(b[:4], uint32(len(p)))
+	binary.LittleEndian.PutUint32(b[4:headerLen], crc32.Checksum(p, castagnoli))
+	w.buf = b
+
+	n, err := w.f.Write(b)
+	w.size += int64(n)
+	if err != nil {
+		// A partial record would be cut on recovery, but anything appended
+		// after it would be lost with it.
+		w.err = fmt.Errorf("wal: appending: %w", err)
+		return w.err
+	}
+	w.dirty = true
+	if w.opts.Sync == SyncAlways {
+		return w.sync()
+	}
+	return nil
+}
+
+// sync must be called with mu held.
+func (w *Map[K, V]) sync() error {
+	if !w.dirty || w.err != nil {
+		return w.err
+	}
+	if err := w.f.Sync(); err != nil {
+		w.err = fmt.Errorf("wal: syncing: %w", err)
+		return w.err
+	}
+	w.dirty = false
+	return nil
+}
+
+func (w *Map[K, V]) syncer() {
+	defer w.wg.Done()
+	t := time.NewTicker(w.opts.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			w.mu.Lock()
+			w.sync() // sticky, the next write returns it
+			w.mu.Unlock()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Sync fsyncs the log now, whatever the SyncPolicy.
+func (w *Map[K, V]) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.sync()
+}
+
+// maybeCompact compacts once the log is big enough. By then the write is
+// logged and applied, so a failure doesn't fail it: it's kept for CompactErr,
+// and the next try waits until the log has grown by another CompactSize.
+func (w *Map[K, V]) maybeCompact() {
+	if w.opts.CompactSize < 0 || w.size < w.nextCompact {
+		return
+	}
+	if w.compact() != nil {
+		w.nextCompact = w.size + w.opts.CompactSize
+	}
+}
+
+// Compact snapshots the map and empties the log.
+func (w *Map[K, V]) Compact() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.compact()
+}
+
+// CompactErr returns the error of the last compaction, or nil if it worked.
+// Writes don't return compaction errors, as they're logged all the same.
+func (w *Map[K, V]) CompactErr() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.compactErr
+}
+
+// compact must be called with mu held, so that the snapshot has exactly the
+// writes in the log. Should we crash between saving the snapshot and
+// truncating the log, the whole log gets replayed on top of a snapshot that
+// already has it, which ends up in the same state.
+func (w *Map[K, V]) compact() error {
+	w.compactErr = w.compactLog()
+	return w.compactErr
+}
+
+func (w *Map[K, V]) compactLog() error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := codec.SaveFile(filepath.Join(w.dir, SnapshotFile), w.m); err != nil {
+		return fmt.Errorf("wal: compacting: %w", err)
+	}
+	err := w.f.Truncate(0)
+	if err == nil {
+		_, err = w.f.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		err = w.f.Sync()
+	}
+	if err != nil {
+		w.err = fmt.Errorf("wal: compacting: %w", err)
+		return w.err
+	}
+	w.size = 0
+	w.dirty = false
+	w.nextCompact = w.opts.CompactSize
+	return nil
+}
+
+// Size is the current size of the log in bytes.
+func (w *Map[K, V]) Size() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.size
+}
+
+// Close fsyncs and closes the log. Writes after Close return ErrClosed,
+// reads keep working.
+func (w *Map[K, V]) Close() error {
+	// Once, so that concurrent calls don't both close done, and the later
+	// ones wait until the log is closed.
+	var err error
+	w.closeOnce.Do(func() { err = w.close() })
+	return err
+}
+
+func (w *Map[K, V]) close() error {
+	close(w.done)
+	w.wg.Wait() // the syncer takes mu
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.sync()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	w.err = ErrClosed
+	return err
+}
@@ -0,0 +1,314 @@
+package wal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/antoniomo/gobench/pkg/lock"
+	"github.com/antoniomo/gobench/pkg/rwlock"
+)
+
+var backends = map[string]func() Backend[string, string]{
+	"lock":   func() Backend[string, string] { return lock.New[string, string]() },
+	"rwlock": func() Backend[string, string] { return rwlock.New[string, string]() },
+}
+
+func open(t *testing.T, dir string, newMap func() Backend[string, string], opts Options) *Map[string, string] {
+	t.Helper()
+	w, err := Open(dir, newMap(), opts)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return w
+}
+
+// write sets key i to i for i in [from, to), and deletes every third key.
+func write(t *testing.T, w *Map[string, string], want map[string]string, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		k := strconv.Itoa(i)
+		if err := w.Set(k, k); err != nil {
+			t.Fatal(err)
+		}
+		want[k] = k
+		if i%3 == 0 {
+			if err := w.Delete(k); err != nil {
+				t.Fatal(err)
+			}
+			delete(want, k)
+		}
+	}
+}
+
+func check(t *testing.T, w *Map[string, string], want map[string]string) {
+	t.Helper()
+	if got := w.Snapshot(); !maps.Equal(got, want) {
+		t.Fatalf("recovered %d entries, want %d:\ngot  %v\nwant %v", len(got), len(want), got, want)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	for name, newMap := range backends {
+		for _, sync := range []SyncPolicy{SyncAlways, SyncInterval, SyncNever} {
+			t.Run(name+"/"+sync.String(), func(t *testing.T) {
+				dir := t.TempDir()
+				opts := Options{Sync: sync, Interval: time.Millisecond}
+				w := open(t, dir, newMap, opts)
+				want := map[string]string{}
+				write(t, w, want, 0, 100)
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if err := w.Set("late", "x"); err != ErrClosed {
+					t.Fatalf("Set after Close returned %v; want ErrClosed", err)
+				}
+
+				w = open(t, dir, newMap, opts)
+				check(t, w, want)
+				write(t, w, want, 100, 200)
+				w.Close()
+
+				w = open(t, dir, newMap, opts)
+				defer w.Close()
+				check(t, w, want)
+			})
+		}
+	}
+}
+
+func TestConcurrentClose(t *testing.T) {
+	w := open(t, t.TempDir(), backends["lock"], Options{Sync: SyncInterval, Interval: time.Millisecond})
+	want := map[string]string{}
+	write(t, w, want, 0, 10)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := w.Close(); err != nil {
+				t.Error(err)
+			}
+			// Whichever call closed it, it's closed once Close returns.
+			if err := w.Set("late", "x"); err != ErrClosed {
+				t.Errorf("Set after Close returned %v; want ErrClosed", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRecoveryWithoutClose(t *testing.T) {
+	dir := t.TempDir()
+	w := open(t, dir, backends["rwlock"], Options{Sync: SyncNever})
+	want := map[string]string{}
+	write(t, w, want, 0, 100)
+	// No Close: the records are in the page cache, which is all a process
+	// crash needs.
+	r := open(t, dir, backends["rwlock"], Options{Sync: SyncNever})
+	defer r.Close()
+	check(t, r, want)
+}
+
+// logged fills a log and closes it, returning what the map should be without
+// its last record, and how long that record is.
+func logged(t *testing.T, dir string) (withoutLast map[string]string, lastLen int64) {
+	t.Helper()
+	w := open(t, dir, backends["lock"], Options{})
+	withoutLast = map[string]string{}
+	write(t, w, withoutLast, 0, 49)
+	before := w.Size()
+	if err := w.Set("last", "record"); err != nil {
+		t.Fatal(err)
+	}
+	lastLen = w.Size() - before
+	w.Close()
+	return withoutLast, lastLen
+}
+
+func TestTruncatedTail(t *testing.T) {
+	for name, newMap := range backends {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			want, lastLen := logged(t, dir)
+			path := filepath.Join(dir, LogFile)
+			good, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for cut := int64(1); cut <= lastLen; cut++ {
+				if err := os.WriteFile(path, good[:int64(len(good))-cut], 0o644); err != nil {
+					t.Fatal(err)
+				}
+				w := open(t, dir, newMap, Options{})
+				check(t, w, want)
+				w.Close()
+			}
+
+			// The torn tail is gone, new records aren't stuck behind it.
+			w := open(t, dir, newMap, Options{})
+			w.Set("after", "crash")
+			w.Close()
+			want["after"] = "crash"
+			w = open(t, dir, newMap, Options{})
+			defer w.Close()
+			check(t, w, want)
+		})
+	}
+}
+
+func TestCorruptTail(t *testing.T) {
+	for name, newMap := range backends {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			want, lastLen := logged(t, dir)
+			path := filepath.Join(dir, LogFile)
+			good, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := len(good) - int(lastLen); i < len(good); i++ {
+				b := append([]byte(nil), good...)
+				b[i] ^= 0x10
+				if err := os.WriteFile(path, b, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				w := open(t, dir, newMap, Options{})
+				check(t, w, want)
+				if size := w.Size(); size != int64(len(good))-lastLen {
+					t.Fatalf("flipped byte %d: log is %d bytes after recovery; want %d", i, size, int64(len(good))-lastLen)
+				}
+				w.Close()
+			}
+		})
+	}
+}
+
+func TestCorruptMiddle(t *testing.T) {
+	dir := t.TempDir()
+	logged(t, dir)
+	path := filepath.Join(dir, LogFile)
+	good, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every byte of the first record, which has 48 good ones after it.
+	first := headerLen + int(binary.LittleEndian.Uint32(good[:4]))
+	for i := 0; i < first; i++ {
+		b := append([]byte(nil), good...)
+		b[i] ^= 0x10
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if w, err := Open(dir, backends["lock"](), Options{}); !errors.Is(err, ErrCorrupt) {
+			if err == nil {
+				w.Close()
+			}
+			t.Fatalf("flipped byte %d: Open returned %v; want ErrCorrupt", i, err)
+		}
+		if after, err := os.ReadFile(path); err != nil || !bytes.Equal(after, b) {
+			t.Fatalf("flipped byte %d: Open changed the log", i)
+		}
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	for name, newMap := range backends {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := Options{Sync: SyncNever, CompactSize: 1 << 10}
+			w := open(t, dir, newMap, opts)
+			want := map[string]string{}
+			write(t, w, want, 0, 1000)
+			if size := w.Size(); size >= opts.CompactSize {
+				t.Fatalf("log is %d bytes; want it compacted under %d", size, opts.CompactSize)
+			}
+			if _, err := os.Stat(filepath.Join(dir, SnapshotFile)); err != nil {
+				t.Fatalf("no snapshot after compaction: %v", err)
+			}
+			w.Close()
+
+			w = open(t, dir, newMap, opts)
+			check(t, w, want)
+			if err := w.Compact(); err != nil {
+				t.Fatal(err)
+			}
+			if w.Size() != 0 {
+				t.Fatalf("log is %d bytes after Compact; want 0", w.Size())
+			}
+			w.Close()
+
+			w = open(t, dir, newMap, opts)
+			defer w.Close()
+			check(t, w, want)
+		})
+	}
+}
+
+func TestCompactionFailure(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{Sync: SyncNever, CompactSize: 1 << 10}
+	w := open(t, dir, backends["lock"], opts)
+	defer w.Close()
+	// A directory in the way makes saving the snapshot fail.
+	if err := os.MkdirAll(filepath.Join(dir, SnapshotFile, "in the way"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{}
+	write(t, w, want, 0, 100) // fails the test if a write returns an error
+	if w.CompactErr() == nil {
+		t.Fatal("CompactErr() = nil after a failed compaction")
+	}
+	if w.Size() < opts.CompactSize {
+		t.Fatalf("log is %d bytes; want it left as it was", w.Size())
+	}
+	if w.nextCompact < w.Size() {
+		t.Fatalf("next compaction at %d bytes, the log is %d: it would be tried on every write", w.nextCompact, w.Size())
+	}
+
+	if err := os.RemoveAll(filepath.Join(dir, SnapshotFile)); err != nil {
+		t.Fatal(err)
+	}
+	write(t, w, want, 100, 300)
+	if err := w.CompactErr(); err != nil {
+		t.Fatalf("CompactErr() = %v after the log grew and compacted again", err)
+	}
+	w.Close()
+
+	w = open(t, dir, backends["lock"], opts)
+	defer w.Close()
+	check(t, w, want)
+}
+
+func TestCompactionCrash(t *testing.T) {
+	// A crash after the snapshot is saved but before the log is truncated
+	// replays the log on top of a snapshot that already has it.
+	dir := t.TempDir()
+	w := open(t, dir, backends["rwlock"], Options{CompactSize: -1})
+	want := map[string]string{}
+	write(t, w, want, 0, 100)
+	log, err := os.ReadFile(filepath.Join(dir, LogFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if err := os.WriteFile(filepath.Join(dir, LogFile), log, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	w = open(t, dir, backends["rwlock"], Options{})
+	defer w.Close()
+	check(t, w, want)
+}
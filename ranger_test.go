@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"encoding/gob"
 	"encoding/json"
+	"maps"
 	"strconv"
 	"sync"
 	"testing"
+
+	"github.com/antoniomo/gobench/pkg/codec"
 )
 
 const maxrangebuf = 10
@@ -170,7 +173,7 @@ func BenchmarkGobSnapshot100(b *testing.B) {
 		r := bytes.NewReader(buf.Bytes())
 		dec := gob.NewDecoder(r)
 		var sn []string
-		dec.Decode(sn)
+		dec.Decode(&sn)
 		for _, s := range sn {
 			_ = s
 		}
@@ -409,8 +412,32 @@ func BenchmarkGobSnapshotMap100(b *testing.B) {
 		l.RUnlock()
 		r := bytes.NewReader(buf.Bytes())
 		dec := gob.NewDecoder(r)
-		var sn []string
-		dec.Decode(sn)
+		var sn map[string]string
+		dec.Decode(&sn)
+		for _, s := range sn {
+			_ = s
+		}
+	}
+}
+
+func BenchmarkCodecSnapshotMap100(b *testing.B) {
+
+	// Setup
+	var (
+		m = make(map[string]string)
+		l sync.RWMutex
+	)
+	for i := 0; i < 100; i++ {
+		s := strconv.Itoa(i)
+		m[s] = s
+	}
+
+	for i := 0; i < b.N; i++ {
+		var buf bytes.Buffer
+		l.RLock()
+		codec.Encode(&buf, len(m), maps.All(m))
+		l.RUnlock()
+		sn, _, _ := codec.Decode[string, string](&buf)
 		for _, s := range sn {
 			_ = s
 		}